@@ -2,12 +2,13 @@ package main
 
 import (
 	"bufio"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 // RunAddInteractive launches a CLI wizard to add a new host to wssh and ssh config
@@ -63,7 +64,7 @@ func RunAddInteractive(cfg *Config) error {
 	}
 
 	// --- SSH AGENT SELECTION ---
-	var identityFile string
+	var agentEnv string
 	if authType == "key" {
 		fmt.Println("\nAvailable SSH Agent Environments:")
 		
@@ -88,69 +89,292 @@ func RunAddInteractive(cfg *Config) error {
 			}
 		}
 
-		if envConfig, exists := cfg.Settings.SSHAgentEnvs[selectedEnv]; exists {
-			identityFile = envConfig.Key
+		if _, exists := cfg.Settings.SSHAgentEnvs[selectedEnv]; exists {
+			agentEnv = selectedEnv
 		} else {
-			fmt.Println("\nWarning: Invalid env choice. No IdentityFile will be added to SSH config.")
+			fmt.Println("\nWarning: Invalid env choice. The host will use the matching agent env rules.")
 		}
 	}
 	
-	// 1. Update wssh.yaml Data Structure
-	groupFound := false
-	for i, g := range cfg.Groups {
-		if strings.EqualFold(g.Name, groupName) {
-			cfg.Groups[i].Hosts = append(cfg.Groups[i].Hosts, Host{
-				Alias:    alias,
-				Hostname: hostname,
-				Tags:     tags,
-			})
-			groupFound = true
-			break
-		}
+	return addHosts(cfg, []hostSpec{{
+		Alias:    alias,
+		Hostname: hostname,
+		Group:    groupName,
+		Tags:     tags,
+		Auth:     authType,
+		Env:      agentEnv,
+	}})
+}
+
+// hostSpec is one host to add, from the wizard, the flags or a --from file
+type hostSpec struct {
+	Alias    string   `json:"alias"`
+	Hostname string   `json:"hostname"`
+	Group    string   `json:"group"`
+	Tags     []string `json:"tags,omitempty"`
+	Auth     string   `json:"auth,omitempty"` // key (default) or password
+	Env      string   `json:"env,omitempty"`  // ssh_agent_envs entry used with key auth
+	User     string   `json:"user,omitempty"`
+	Port     int      `json:"port,omitempty"`
+}
+
+// fillFrom uses the values of defaults (the flags) for the fields a row leaves empty
+func (s *hostSpec) fillFrom(defaults hostSpec) {
+	if s.Group == "" {
+		s.Group = defaults.Group
 	}
-	
-	// If it's a brand new group, create it
-	if !groupFound {
-		cfg.Groups = append(cfg.Groups, Group{
-			Name:  groupName,
-			Hosts: []Host{{Alias: alias, Hostname: hostname, Tags: tags}},
-		})
+	if len(s.Tags) == 0 {
+		s.Tags = defaults.Tags
+	}
+	if s.Auth == "" {
+		s.Auth = defaults.Auth
+	}
+	if s.Env == "" {
+		s.Env = defaults.Env
+	}
+	if s.User == "" {
+		s.User = defaults.User
 	}
+	if s.Port == 0 {
+		s.Port = defaults.Port
+	}
+}
+
+func (s hostSpec) host() Host {
+	h := Host{Alias: s.Alias, Hostname: s.Hostname, Tags: s.Tags}
+	h.User = s.User
+	h.Port = s.Port
+	h.AgentEnv = s.Env
+	if s.Auth == "password" {
+		// Keep the agent env rules from giving the host a key or socket
+		h.AgentEnv = noAgentEnv
+		h.SSHOptions = map[string]string{"PreferredAuthentications": "keyboard-interactive,password"}
+	}
+	return h
+}
 
-	// 2. Write to ~/.wssh.yaml
-	homeDir, err := os.UserHomeDir()
+// RunAdd adds the host described by the flags, or every host of a --from file,
+// without prompting
+func RunAdd(cfg *Config, spec hostSpec, from string) error {
+	if from == "" {
+		return addHosts(cfg, []hostSpec{spec})
+	}
+
+	specs, err := readHostSpecs(from)
 	if err != nil {
 		return err
 	}
-	wsshPath := filepath.Join(homeDir, ".wssh.yaml")
-	
-	yamlData, err := yaml.Marshal(cfg)
+	if len(specs) == 0 {
+		return fmt.Errorf("%s has no hosts", from)
+	}
+	for i := range specs {
+		specs[i].fillFrom(spec)
+	}
+	return addHosts(cfg, specs)
+}
+
+// readHostSpecs reads hosts from a CSV file with a header row, or a JSON list
+// of objects, using the same field names. "-" reads standard input.
+func readHostSpecs(path string) ([]hostSpec, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal YAML: %v", err)
+		return nil, err
 	}
-	
-	if err := os.WriteFile(wsshPath, yamlData, 0644); err != nil {
-		return fmt.Errorf("failed to write ~/.wssh.yaml: %v", err)
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasSuffix(strings.ToLower(path), ".json") || strings.HasPrefix(trimmed, "[") {
+		var specs []hostSpec
+		dec := json.NewDecoder(strings.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&specs); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return specs, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(trimmed)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	var specs []hostSpec
+	for line, record := range records[1:] {
+		var s hostSpec
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			switch strings.ToLower(strings.TrimSpace(column)) {
+			case "alias":
+				s.Alias = value
+			case "hostname":
+				s.Hostname = value
+			case "group":
+				s.Group = value
+			case "tags":
+				// Tags are separated by ; or by commas inside a quoted field
+				s.Tags = splitTags(strings.ReplaceAll(value, ";", ","))
+			case "auth":
+				s.Auth = value
+			case "env":
+				s.Env = value
+			case "user":
+				s.User = value
+			case "port":
+				if value == "" {
+					continue
+				}
+				if s.Port, err = strconv.Atoi(value); err != nil {
+					return nil, fmt.Errorf("%s:%d: invalid port '%s'", path, line+2, value)
+				}
+			default:
+				return nil, fmt.Errorf("%s: unknown column '%s' (expected alias, hostname, group, tags, auth, env, user, port)", path, column)
+			}
+		}
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// checkHostSpecs returns every problem with the hosts to add: missing fields,
+// aliases already in the inventory, in ~/.ssh/config or twice in the batch
+func checkHostSpecs(cfg *Config, specs []hostSpec) []string {
+	// Hosts in ~/.ssh/config that wssh doesn't manage
+	sshHosts, _, err := ParseSSHConfig(sshConfigPath())
+	if err != nil && !os.IsNotExist(err) {
+		return []string{fmt.Sprintf("failed to read ~/.ssh/config: %v", err)}
 	}
-	fmt.Println("\n✅ Added successfully to ~/.wssh.yaml")
+	sshDefined := make(map[string]SSHConfigHost)
+	for _, h := range sshHosts {
+		if !h.Managed {
+			sshDefined[h.Alias] = h
+		}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for i, s := range specs {
+		name := s.Alias
+		if name == "" {
+			name = fmt.Sprintf("host %d", i+1)
+		}
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+		}
 
-	// 3. Append to ~/.ssh/config
-	sshConfigPath := filepath.Join(homeDir, ".ssh", "config")
-	f, err := os.OpenFile(sshConfigPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		switch {
+		case s.Alias == "":
+			problem("alias cannot be empty")
+		case checkNewName("host", s.Alias) != nil:
+			problem("%v", checkNewName("host", s.Alias))
+		case seen[s.Alias]:
+			problem("listed more than once")
+		case cfg.origins["hosts."+s.Alias] != "":
+			problem("already in the inventory (%s)", shortPath(cfg.origins["hosts."+s.Alias]))
+		default:
+			if h, exists := sshDefined[s.Alias]; exists {
+				problem("already defined in %s:%d (add it with 'wssh import ssh-config' instead)", shortPath(h.File), h.Line)
+			}
+		}
+		seen[s.Alias] = true
+
+		if s.Hostname == "" {
+			problem("hostname/IP cannot be empty")
+		}
+		if s.Group == "" {
+			problem("group cannot be empty")
+		} else if err := checkNewName("group", s.Group); err != nil {
+			problem("%v", err)
+		}
+		if s.Port < 0 || s.Port > 65535 {
+			problem("invalid port %d", s.Port)
+		}
+		switch s.Auth {
+		case "", "key":
+			if _, exists := cfg.Settings.SSHAgentEnvs[s.Env]; s.Env != "" && !exists {
+				problem("unknown env '%s'", s.Env)
+			}
+		case "password":
+			if s.Env != "" {
+				problem("env is only used with key auth")
+			}
+		default:
+			problem("unknown auth '%s' (expected key or password)", s.Auth)
+		}
+	}
+	return problems
+}
+
+// addHosts checks every host, then adds them all to the config and the wssh
+// block of ~/.ssh/config in one write. Nothing is written if any host has a problem.
+func addHosts(cfg *Config, specs []hostSpec) error {
+	if problems := checkHostSpecs(cfg, specs); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Printf("  - %s\n", p)
+		}
+		return fmt.Errorf("%d problem(s) found, nothing was written", len(problems))
+	}
+
+	// 1. Edit the config, touching only the groups we add to
+	file, err := OpenConfigFile(cfg.path)
+	if err != nil {
+		return err
+	}
+	for _, s := range specs {
+		newHost := s.host()
+		if err := file.AddHost(s.Group, newHost); err != nil {
+			return err
+		}
+
+		// Keep the in-memory inventory in step, for the ssh_config block
+		if i := cfg.groupIndex(s.Group); i >= 0 {
+			cfg.Groups[i].Hosts = append(cfg.Groups[i].Hosts, newHost)
+		} else {
+			cfg.Groups = append(cfg.Groups, Group{Name: s.Group, Hosts: []Host{newHost}})
+		}
+	}
+	wsshData, err := file.Bytes()
 	if err != nil {
-		return fmt.Errorf("failed to open ~/.ssh/config: %v", err)
+		return err
 	}
-	defer f.Close()
 
-	sshBlock := fmt.Sprintf("\nHost %s\n    HostName %s\n", alias, hostname)
-	if identityFile != "" {
-		sshBlock += fmt.Sprintf("    IdentityFile %s\n", identityFile)
+	// 2. Regenerate the wssh block of ~/.ssh/config from the updated inventory
+	sshSync, err := planSSHConfigSync(cfg)
+	if err != nil {
+		return err
 	}
 
-	if _, err := f.WriteString(sshBlock); err != nil {
-		return fmt.Errorf("failed to write to ~/.ssh/config: %v", err)
+	// 3. Write the files together, so they are never left out of sync
+	reason := fmt.Sprintf("add %s to group %s", specs[0].Alias, specs[0].Group)
+	if len(specs) > 1 {
+		reason = fmt.Sprintf("add %d hosts", len(specs))
+	}
+	writes := append([]fileWrite{{Path: cfg.path, Data: wsshData, Perm: 0644}}, sshSync.writes...)
+	backupDir, keep := backupSettings(cfg.Settings)
+	if err := commitWrites(backupDir, keep, reason, writes...); err != nil {
+		return err
+	}
+	if dryRun != nil {
+		return nil
+	}
+
+	if len(specs) == 1 {
+		fmt.Printf("\n✅ Added successfully to %s\n", cfg.path)
+	} else {
+		fmt.Printf("\n✅ Added %d hosts to %s\n", len(specs), cfg.path)
+	}
+	fmt.Println("✅ Updated the wssh block in ~/.ssh/config")
+	for _, w := range sshSync.warnings {
+		fmt.Printf("warning: %s\n", w)
 	}
-	fmt.Println("✅ Appended successfully to ~/.ssh/config")
 
 	return nil
 }
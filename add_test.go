@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestPasswordHostSkipsAgentEnvs checks that --auth password is kept in the
+// inventory, so agent env rules can't hand the host a key or socket
+func TestPasswordHostSkipsAgentEnvs(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	cfg := &Config{Settings: Settings{SSHAgentEnvs: map[string]AgentEnv{
+		"default": {Sock: "~/.ssh/default.sock", Key: "~/.ssh/id_ed25519"},
+		"prod":    {Sock: "~/.ssh/prod.sock", Key: "~/.ssh/prod_key", Groups: []string{"prod"}},
+	}}}
+
+	tests := []struct {
+		auth    string
+		env     string
+		agent   string // Resolved env, "" for none
+		options map[string]string
+	}{
+		{auth: "", agent: "prod"},
+		{auth: "key", env: "default", agent: "default"},
+		{auth: "password", options: map[string]string{"PreferredAuthentications": "keyboard-interactive,password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.auth, func(t *testing.T) {
+			spec := hostSpec{Alias: "prod-db-09", Hostname: "10.0.0.9", Group: "prod", Auth: tt.auth, Env: tt.env}
+			if problems := checkHostSpecs(cfg, []hostSpec{spec}); len(problems) > 0 {
+				t.Fatalf("unexpected problems: %v", problems)
+			}
+			h := spec.host()
+			if !reflect.DeepEqual(h.SSHOptions, tt.options) {
+				t.Errorf("ssh_options = %v, want %v", h.SSHOptions, tt.options)
+			}
+
+			searchable := SearchableHost{Alias: h.Alias, Hostname: h.Hostname, GroupName: spec.Group, SSH: h.SSHSettings}
+			match, ok := ResolveAgentEnv(searchable, cfg)
+			if got := match.Name; ok != (tt.agent != "") || got != tt.agent {
+				t.Errorf("agent env = %q (%v), want %q", got, ok, tt.agent)
+			}
+			if got := managedIdentityFile(searchable, cfg); tt.auth == "password" && got != "" {
+				t.Errorf("managed IdentityFile = %q, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Rule kinds, weakest first: when two envs have the same priority the later kind wins
+const (
+	matchByTag = iota
+	matchByGroup
+	matchByAlias
+)
+
+// noAgentEnv as agent_env keeps a host off every agent env, e.g. password hosts
+// from 'wssh add --auth password'. An env actually named "none" still wins.
+const noAgentEnv = "none"
+
+// AgentMatch is the agent environment a host resolved to, and why
+type AgentMatch struct {
+	Name   string
+	Env    AgentEnv
+	Reason string
+}
+
+// agentCandidate is one env whose rules matched the host
+type agentCandidate struct {
+	name     string
+	priority int
+	kind     int
+	length   int // Literal characters in the matching rule, longer is more specific
+	reason   string
+}
+
+// ResolveAgentEnv picks the ssh agent environment for a host. The order is:
+//  1. agent_env named on the host, or else on its group ("none" for no env)
+//  2. envs whose match rules hit: highest priority, then alias rules over group
+//     rules over tag rules, then the longest (most literal) pattern, then env name
+//  3. the "default" env
+//
+// Envs without any rules act as an alias prefix (`dev` matches `dev-web-01`), so
+// with overlapping names like `dev` and `dev-eu` the longer prefix always wins.
+func ResolveAgentEnv(host SearchableHost, cfg *Config) (AgentMatch, bool) {
+	envs := cfg.Settings.SSHAgentEnvs
+
+	// 1. Explicitly named on the host or group (unknown names fall through to the rules)
+	if name := host.SSH.AgentEnv; name != "" {
+		if env, exists := envs[name]; exists {
+			return AgentMatch{Name: name, Env: env, Reason: "agent_env"}, true
+		}
+		if name == noAgentEnv {
+			return AgentMatch{}, false
+		}
+	}
+
+	// 2. Collect every env whose rules match
+	var candidates []agentCandidate
+	for name, env := range envs {
+		if c, ok := matchAgentEnv(name, env, host); ok {
+			candidates = append(candidates, c)
+		}
+	}
+
+	if len(candidates) > 0 {
+		sort.Slice(candidates, func(i, j int) bool {
+			a, b := candidates[i], candidates[j]
+			if a.priority != b.priority {
+				return a.priority > b.priority
+			}
+			if a.kind != b.kind {
+				return a.kind > b.kind
+			}
+			if a.length != b.length {
+				return a.length > b.length
+			}
+			return a.name < b.name
+		})
+		best := candidates[0]
+		return AgentMatch{Name: best.name, Env: envs[best.name], Reason: best.reason}, true
+	}
+
+	// 3. Fallback: If nothing matched, use the "default" agent if configured
+	if defaultEnv, exists := envs["default"]; exists {
+		return AgentMatch{Name: "default", Env: defaultEnv, Reason: "default"}, true
+	}
+
+	return AgentMatch{}, false
+}
+
+// matchAgentEnv returns the strongest rule of env that matches the host
+func matchAgentEnv(name string, env AgentEnv, host SearchableHost) (agentCandidate, bool) {
+	best := agentCandidate{name: name, priority: env.Priority, kind: -1}
+	consider := func(kind, length int, reason string) {
+		if kind > best.kind || (kind == best.kind && length > best.length) {
+			best.kind, best.length, best.reason = kind, length, reason
+		}
+	}
+
+	// An env without rules matches aliases starting with its name (the default env never does)
+	patterns := env.Match
+	if len(env.Match) == 0 && len(env.Groups) == 0 && len(env.Tags) == 0 && name != "default" {
+		patterns = []string{name + "*"}
+	}
+
+	for _, pattern := range patterns {
+		if matchAliasPattern(pattern, host.Alias) {
+			consider(matchByAlias, literalLength(pattern), fmt.Sprintf("alias matches %s", pattern))
+		}
+	}
+	for _, g := range env.Groups {
+		if strings.EqualFold(g, host.GroupName) {
+			consider(matchByGroup, len(g), fmt.Sprintf("group %s", g))
+		}
+	}
+	for _, t := range env.Tags {
+		for _, hostTag := range host.Tags {
+			if strings.EqualFold(t, hostTag) {
+				consider(matchByTag, len(t), fmt.Sprintf("tag %s", t))
+			}
+		}
+	}
+
+	return best, best.kind >= 0
+}
+
+// matchAliasPattern matches a glob, or a regex when the pattern is written as /.../
+func matchAliasPattern(pattern, alias string) bool {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false
+		}
+		return re.MatchString(alias)
+	}
+	matched, err := path.Match(pattern, alias)
+	return err == nil && matched
+}
+
+// literalLength counts the characters of a pattern that are not wildcards
+func literalLength(pattern string) int {
+	special := "*?[]"
+	if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		special = "/^$.*+?()[]{}|\\"
+	}
+	return len(strings.Map(func(r rune) rune {
+		if strings.ContainsRune(special, r) {
+			return -1
+		}
+		return r
+	}, pattern))
+}
+
+// getSocketForHost determines the SSH_AUTH_SOCK for a host from its agent environment
+func getSocketForHost(host SearchableHost, cfg *Config) string {
+	if match, ok := ResolveAgentEnv(host, cfg); ok {
+		return match.Env.Sock
+	}
+
+	// Absolute fallback: Return empty so SSH uses the system default
+	return ""
+}
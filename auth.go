@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -78,8 +79,15 @@ func CheckAndPrimeAgents(cfg *Config) error {
 	fileInfo, _ := os.Stat(targetKey)
 	fmt.Printf("\033[1;32m[VALID]\033[0m Keys are fresh (updated %s).\n\n", fileInfo.ModTime().Format(time.Kitchen))
 
-	// 2. Loop through dynamic config to prime agents
-	for envName, config := range cfg.Settings.SSHAgentEnvs {
+	// 2. Loop through dynamic config to prime agents (sorted so the output is stable)
+	var envNames []string
+	for envName := range cfg.Settings.SSHAgentEnvs {
+		envNames = append(envNames, envName)
+	}
+	sort.Strings(envNames)
+
+	for _, envName := range envNames {
+		config := cfg.Settings.SSHAgentEnvs[envName]
 		fmt.Printf("--- Setting up Agent for: %s ---\n", envName)
 
 		sockPath := expandPath(config.Sock)
@@ -92,21 +100,23 @@ func CheckAndPrimeAgents(cfg *Config) error {
 			fmt.Printf("Socket %s is alive.\n", sockPath)
 		} else {
 			fmt.Printf("Socket %s missing or dead. Starting new agent...\n", sockPath)
-			os.Remove(sockPath)
+			if dryRun == nil {
+				os.Remove(sockPath)
+			}
 			
 			agentCmd := exec.Command("ssh-agent", "-a", sockPath)
-			agentCmd.Run()
+			runCommand(agentCmd)
 		}
 
 		flushCmd := exec.Command("ssh-add", "-D")
 		flushCmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sockPath)
-		flushCmd.Run()
+		runCommand(flushCmd)
 
 		if _, err := os.Stat(keyPath); err == nil {
 			addCmd := exec.Command("ssh-add", keyPath)
 			addCmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sockPath)
 			
-			if err := addCmd.Run(); err == nil {
+			if err := runCommand(addCmd); err == nil {
 				fmt.Printf("Successfully updated %s agent with %s\n\n", envName, keyPath)
 			} else {
 				fmt.Printf("Failed to add key to %s agent.\n\n", envName)
@@ -116,4 +126,22 @@ func CheckAndPrimeAgents(cfg *Config) error {
 		}
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+// PrintAgentResolution shows which agent environment every host resolves to
+func PrintAgentResolution(hosts []SearchableHost, cfg *Config) {
+	fmt.Println("--- Agent Environment per Host ---")
+	for _, h := range hosts {
+		match, ok := ResolveAgentEnv(h, cfg)
+		if !ok {
+			fmt.Printf("  %-25s -> (system agent)\n", h.Alias)
+			continue
+		}
+
+		note := match.Reason
+		if h.SSH.AgentEnv != "" && h.SSH.AgentEnv != match.Name {
+			note += fmt.Sprintf(", agent_env '%s' not found", h.SSH.AgentEnv)
+		}
+		fmt.Printf("  %-25s -> %-12s (%s)\n", h.Alias, match.Name, note)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// SplitDirection says where a new pane goes relative to the one being split
+type SplitDirection int
+
+const (
+	SplitBelow SplitDirection = iota // Horizontal divider, new pane underneath
+	SplitRight                       // Vertical divider, new pane to the right
+)
+
+// Backend is a terminal emulator or multiplexer wssh can build sessions in.
+// Panes are addressed by the numbers wssh gives them: OpenTab creates pane 1
+// and every SplitPane call introduces a new number.
+// Backends may queue work until Flush is called.
+type Backend interface {
+	Name() string
+	// OpenTab opens a new tab (or window) whose first pane runs cmd
+	OpenTab(host SearchableHost, cmd string) error
+	// SplitPane splits pane `from` and runs cmd in the new pane `to`.
+	// percent is the share of the old pane's space given to the new one.
+	SplitPane(from, to int, dir SplitDirection, percent int, host SearchableHost, cmd string) error
+	// NameSession sets the title shown for a pane
+	NameSession(pane int, name string) error
+	// Flush executes everything queued since OpenTab
+	Flush() error
+	// Attach brings the user to the new tabs, once every tab is open
+	Attach() error
+	// SendText types text into the currently active pane and presses enter
+	SendText(text string) error
+}
+
+// NewBackend picks the backend from settings.terminal, auto-detecting it when unset
+func NewBackend(cfg *Config) (Backend, error) {
+	switch cfg.Settings.Terminal {
+	case "", "auto":
+		return detectBackend(), nil
+	case "iterm", "iterm2":
+		return &itermBackend{}, nil
+	case "tmux":
+		return &tmuxBackend{}, nil
+	default:
+		return nil, fmt.Errorf("unknown terminal '%s' in settings (expected auto, iterm or tmux)", cfg.Settings.Terminal)
+	}
+}
+
+// detectBackend prefers the terminal we are running in, then what the OS has available
+func detectBackend() Backend {
+	// 1. Already inside tmux (e.g. on a Linux jump host)
+	if os.Getenv("TMUX") != "" {
+		return &tmuxBackend{}
+	}
+
+	// 2. Running in iTerm2 or on a Mac where iTerm2 is the default
+	if os.Getenv("TERM_PROGRAM") == "iTerm.app" || runtime.GOOS == "darwin" {
+		return &itermBackend{}
+	}
+
+	// 3. Anywhere else tmux is the only thing we know how to drive
+	if _, err := exec.LookPath("tmux"); err == nil {
+		return &tmuxBackend{}
+	}
+	return &itermBackend{}
+}
+
+// applyLayout drives a backend through the split sequence of a layout.
+// Panes are numbered row by row (pane 1 is top-left) and panes[i] runs in pane i+1.
+// Rows are created first by splitting the previous row's first pane below,
+// then each row is filled left to right by splitting to the right.
+func applyLayout(b Backend, l Layout, panes []launchPane) error {
+	// firstPane[r] is the pane number of the left-most pane in row r
+	firstPane := make([]int, len(l.Rows))
+	next := 1
+	for r, row := range l.Rows {
+		firstPane[r] = next
+		next += row.Panes
+	}
+
+	if err := b.OpenTab(panes[0].Host, panes[0].Command); err != nil {
+		return err
+	}
+
+	// 1. Stack the rows top to bottom. Each split hands the new pane the share
+	// of the remaining height that belongs to the rows below it.
+	rowWeights := l.rowWeights()
+	for r := 1; r < len(l.Rows); r++ {
+		percent := 100 * sumInts(rowWeights[r:]) / sumInts(rowWeights[r-1:])
+		p := panes[firstPane[r]-1]
+		if err := b.SplitPane(firstPane[r-1], firstPane[r], SplitBelow, percent, p.Host, p.Command); err != nil {
+			return err
+		}
+	}
+
+	// 2. Fill each row left to right the same way
+	for r, row := range l.Rows {
+		weights := row.paneWeights()
+		for c := 1; c < row.Panes; c++ {
+			percent := 100 * sumInts(weights[c:]) / sumInts(weights[c-1:])
+			to := firstPane[r] + c
+			p := panes[to-1]
+			if err := b.SplitPane(to-1, to, SplitRight, percent, p.Host, p.Command); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 3. Title every pane after the host it is connected to
+	for i, p := range panes {
+		if err := b.NameSession(i+1, p.Host.Alias); err != nil {
+			return err
+		}
+	}
+
+	return b.Flush()
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultBackupDir  = "~/.wssh_backups"
+	defaultBackupKeep = 20
+	backupManifest    = "backup.json"
+	backupIDFormat    = "20060102-150405"
+	lockFile          = "~/.wssh.lock"
+	lockTimeout       = 10 * time.Second
+)
+
+// fileWrite is one file of a set that is written together
+type fileWrite struct {
+	Path string
+	Data []byte
+	Perm os.FileMode // Used when the file doesn't exist yet
+
+	// Build, when set, produces Data under the lock, for files other wssh
+	// processes also change (e.g. the history). Nil data leaves the file alone.
+	Build func() ([]byte, error)
+}
+
+// Backup is one set of files saved before wssh changed them
+type Backup struct {
+	ID      string       `json:"-"` // Directory name, the time of the backup
+	Created time.Time    `json:"created"`
+	Reason  string       `json:"reason"`
+	Files   []BackupFile `json:"files"`
+}
+
+// BackupFile is a saved copy of one file. Files that didn't exist are
+// recorded too, so restoring the set removes them again.
+type BackupFile struct {
+	Path    string `json:"path"`
+	Name    string `json:"name,omitempty"` // Copy inside the backup directory
+	Missing bool   `json:"missing,omitempty"`
+}
+
+// commitWrites writes a set of files (e.g. ~/.wssh.yaml and ~/.ssh/config) under
+// an advisory lock. Every file is backed up first, then replaced atomically with a
+// temp file and rename. If any write fails, the files already written are rolled
+// back so the set never ends up half updated.
+func commitWrites(backupDir string, keep int, reason string, writes ...fileWrite) error {
+	if dryRun != nil {
+		writes, err := buildWrites(writes)
+		if err != nil {
+			return err
+		}
+		for _, w := range writes {
+			dryRun.record(PlanStep{Kind: "write_file", Path: w.Path, Note: reason})
+		}
+		return nil
+	}
+
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	writes, err = buildWrites(writes)
+	if err != nil {
+		return err
+	}
+	var paths []string
+	for _, w := range writes {
+		paths = append(paths, w.Path)
+	}
+	backup, err := createBackup(backupDir, reason, paths)
+	if err != nil {
+		return fmt.Errorf("failed to back up before writing: %v", err)
+	}
+
+	for i, w := range writes {
+		if err := writeFileAtomic(w.Path, w.Data, w.Perm); err != nil {
+			if rbErr := restoreFiles(backupDir, backup, paths[:i]); rbErr != nil {
+				return fmt.Errorf("failed to write %s: %v (rollback failed: %v)", w.Path, err, rbErr)
+			}
+			return fmt.Errorf("failed to write %s: %v (earlier files were rolled back)", w.Path, err)
+		}
+	}
+
+	pruneBackups(backupDir, keep)
+	return nil
+}
+
+// buildWrites fills in the data of the writes that have a Build func, and drops
+// those with nothing to write
+func buildWrites(writes []fileWrite) ([]fileWrite, error) {
+	var built []fileWrite
+	for _, w := range writes {
+		if w.Build != nil {
+			data, err := w.Build()
+			if err != nil {
+				return nil, fmt.Errorf("failed to prepare %s: %v", w.Path, err)
+			}
+			if data == nil {
+				continue
+			}
+			w.Data = data
+		}
+		built = append(built, w)
+	}
+	return built, nil
+}
+
+// writeFileAtomic replaces path through a temp file in the same directory, so
+// readers see either the old or the new contents, never a truncated file. A
+// symlinked path (dotfile managers) is resolved first, so the link is kept and
+// its target is replaced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// lockConfig takes an exclusive flock on ~/.wssh.lock so concurrent wssh
+// processes don't interleave their writes. Every writer takes the same lock,
+// whichever config or context it uses and whichever files it changes (the
+// config, ~/.ssh/config, the history...). It waits up to lockTimeout.
+func lockConfig() (func(), error) {
+	lockPath := expandPath(lockFile)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %v", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK || time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("could not lock %s, is another wssh writing the config? (%v)", lockPath, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// createBackup copies the current version of each file into a new timestamped
+// directory. When none of the files exist yet there is nothing to save, and the
+// backup is only kept in memory for rolling back.
+func createBackup(backupDir, reason string, paths []string) (Backup, error) {
+	now := time.Now()
+	b := Backup{Created: now, Reason: reason}
+	contents := make(map[string][]byte)
+	for i, path := range paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			b.Files = append(b.Files, BackupFile{Path: path, Missing: true})
+			continue
+		}
+		if err != nil {
+			return Backup{}, err
+		}
+		name := fmt.Sprintf("%d-%s", i+1, strings.TrimPrefix(filepath.Base(path), "."))
+		contents[name] = data
+		b.Files = append(b.Files, BackupFile{Path: path, Name: name})
+	}
+	if len(contents) == 0 {
+		return b, nil
+	}
+
+	root := expandPath(backupDir)
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return Backup{}, err
+	}
+
+	// Two writes in the same second get -2, -3... suffixes
+	b.ID = now.Format(backupIDFormat)
+	for n := 2; ; n++ {
+		err := os.Mkdir(filepath.Join(root, b.ID), 0700)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return Backup{}, err
+		}
+		b.ID = fmt.Sprintf("%s-%d", now.Format(backupIDFormat), n)
+	}
+
+	for name, data := range contents {
+		if err := os.WriteFile(filepath.Join(root, b.ID, name), data, 0600); err != nil {
+			return Backup{}, err
+		}
+	}
+
+	manifest, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return Backup{}, err
+	}
+	return b, os.WriteFile(filepath.Join(root, b.ID, backupManifest), manifest, 0600)
+}
+
+// restoreFiles puts back the saved copies of the given paths (all of them when paths is nil)
+func restoreFiles(backupDir string, b Backup, paths []string) error {
+	root := expandPath(backupDir)
+	for _, f := range b.Files {
+		if paths != nil && !containsString(paths, f.Path) {
+			continue
+		}
+		if f.Missing {
+			if err := os.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, b.ID, f.Name))
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(f.Path, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBackups returns the backups in the directory, newest first
+func ListBackups(backupDir string) ([]Backup, error) {
+	root := expandPath(backupDir)
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(root, e.Name(), backupManifest))
+		if err != nil {
+			continue // Not one of ours
+		}
+		var b Backup
+		if err := json.Unmarshal(data, &b); err != nil {
+			continue
+		}
+		b.ID = e.Name()
+		backups = append(backups, b)
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Created.After(backups[j].Created)
+	})
+	return backups, nil
+}
+
+// RestoreBackup rolls the files of a backup back. The current versions are
+// backed up first, so a restore can itself be undone.
+func RestoreBackup(backupDir string, b Backup) error {
+	if dryRun != nil {
+		for _, f := range b.Files {
+			dryRun.record(PlanStep{Kind: "write_file", Path: f.Path, Note: "restored from backup " + b.ID})
+		}
+		return nil
+	}
+
+	var paths []string
+	for _, f := range b.Files {
+		paths = append(paths, f.Path)
+	}
+
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := createBackup(backupDir, "before restoring "+b.ID, paths); err != nil {
+		return fmt.Errorf("failed to back up the current files: %v", err)
+	}
+	return restoreFiles(backupDir, b, nil)
+}
+
+// pruneBackups deletes all but the newest keep backups
+func pruneBackups(backupDir string, keep int) {
+	backups, err := ListBackups(backupDir)
+	if err != nil || len(backups) <= keep {
+		return
+	}
+	for _, b := range backups[keep:] {
+		os.RemoveAll(filepath.Join(expandPath(backupDir), b.ID))
+	}
+}
+
+// backupSettings returns the backup directory and how many backups to keep
+func backupSettings(s Settings) (string, int) {
+	dir := s.BackupDir
+	if dir == "" {
+		dir = defaultBackupDir
+	}
+	keep := s.BackupKeep
+	if keep <= 0 {
+		keep = defaultBackupKeep
+	}
+	return dir, keep
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RunRestore lists the backups, or restores the one given by number or ID
+func RunRestore(cfg *Config, choice string, yes bool) error {
+	backupDir, _ := backupSettings(cfg.Settings)
+	backups, err := ListBackups(backupDir)
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Printf("No backups found in %s\n", backupDir)
+		return nil
+	}
+
+	if choice == "" {
+		fmt.Printf("--- Backups in %s ---\n", backupDir)
+		for i, b := range backups {
+			fmt.Printf("  %2d) %-18s %s  %s\n", i+1, b.ID, b.Created.Format("01/02 15:04:05"), b.Reason)
+			for _, f := range b.Files {
+				state := ""
+				if f.Missing {
+					state = " (did not exist)"
+				}
+				fmt.Printf("        %s%s\n", f.Path, state)
+			}
+		}
+		fmt.Println("\nRestore one with: wssh config restore <number|id>")
+		return nil
+	}
+
+	var target *Backup
+	for i := range backups {
+		if choice == backups[i].ID || choice == fmt.Sprintf("%d", i+1) {
+			target = &backups[i]
+			break
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("no backup '%s' (run 'wssh config restore' to list them)", choice)
+	}
+
+	fmt.Printf("Restoring %s (%s):\n", target.ID, target.Reason)
+	for _, f := range target.Files {
+		if f.Missing {
+			fmt.Printf("  - %s will be removed (it did not exist)\n", f.Path)
+		} else {
+			fmt.Printf("  - %s\n", f.Path)
+		}
+	}
+	if !yes && dryRun == nil && !askYesNo("\nProceed?") {
+		return nil
+	}
+
+	if err := RestoreBackup(backupDir, *target); err != nil {
+		return err
+	}
+	if dryRun == nil {
+		fmt.Println("✅ Restored. The replaced versions were backed up as well.")
+	}
+	return nil
+}
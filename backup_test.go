@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("new file", func(t *testing.T) {
+		path := filepath.Join(dir, "sub", "new.yaml")
+		if err := writeFileAtomic(path, []byte("a: 1\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("keeps the mode of an existing file", func(t *testing.T) {
+		path := filepath.Join(dir, "config")
+		if err := os.WriteFile(path, []byte("old\n"), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeFileAtomic(path, []byte("new\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+		}
+	})
+
+	t.Run("symlink is kept and its target replaced", func(t *testing.T) {
+		target := filepath.Join(dir, "dotfiles", "wssh.yaml")
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		link := filepath.Join(dir, ".wssh.yaml")
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writeFileAtomic(link, []byte("new\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			t.Fatalf("%s was replaced by a regular file", link)
+		}
+		data, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "new\n" {
+			t.Errorf("target = %q, want %q", data, "new\n")
+		}
+		leftovers, _ := filepath.Glob(filepath.Join(dir, ".wssh.yaml.tmp-*"))
+		if len(leftovers) > 0 {
+			t.Errorf("temp files left next to the link: %v", leftovers)
+		}
+	})
+}
@@ -10,31 +10,6 @@ import (
 	"syscall"
 )
 
-// getSocketForHost dynamically determines the SSH_AUTH_SOCK by matching the host alias
-// prefix against the defined ssh_agent_envs in the config.
-func getSocketForHost(alias string, cfg *Config) string {
-	// 1. Check for a specific environment prefix match (e.g., "dev", "prod")
-	for envName, envData := range cfg.Settings.SSHAgentEnvs {
-		// Skip the default key during the prefix loop
-		if envName == "default" {
-			continue
-		}
-		
-		// If the alias (e.g., "dev-02") starts with "dev"
-		if strings.HasPrefix(alias, envName) {
-			return envData.Sock
-		}
-	}
-
-	// 2. Fallback: If no prefix matched, use the "default" agent if configured
-	if defaultEnv, exists := cfg.Settings.SSHAgentEnvs["default"]; exists {
-		return defaultEnv.Sock
-	}
-
-	// 3. Absolute fallback: Return empty so SSH uses the system default
-	return ""
-}
-
 // ResolveTargetNodes queries the JB to find its true FQDN and the dynamic target nodes
 // Important - This was added because the easiest way to get to the data nodes is through the jumpbox,
 // and the jumpbox knows the FQDN of the data nodes, which can change at any time. 
@@ -43,27 +18,25 @@ func getSocketForHost(alias string, cfg *Config) string {
 func ResolveTargetNodes(jbAlias, nodeList string, cfg *Config) ([]string, string, error) {
 	fmt.Printf("🔍 Connecting to %s to resolve true FQDN and node mappings...\n", jbAlias)
 
-	sockPath := getSocketForHost(jbAlias, cfg)
-
 	// Pull the command from the config, fallback to a safe default if empty
     remoteCmd := cfg.Settings.CaptureCommand
     if remoteCmd == "" {
         remoteCmd = "hostname -f" 
     }
 
-	sshArgs := []string{
-		"-o", "StrictHostKeyChecking=no", 
-		"-o", "UserKnownHostsFile=/dev/null",
-		jbAlias, 
-		remoteCmd,
-	}
-	
-	cmd := exec.Command("ssh", sshArgs...)
-	
-	// Inject the SSH_AUTH_SOCK environment variable!
-	if sockPath != "" {
-		cmd.Env = os.Environ()
-		cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", sockPath))
+	// The builder injects the SSH_AUTH_SOCK environment variable for the jumpbox!
+	sshCmd := NewSSH(cfg.LookupHost(jbAlias), cfg, remoteCmd)
+	sockPath := sshCmd.AgentSock
+	cmd := sshCmd.Cmd()
+
+	// Without the jumpbox output we can only name the nodes we were asked for
+	if dryRun != nil {
+		dryRun.record(commandStep(cmd))
+		var placeholders []string
+		for _, reqNode := range strings.Split(nodeList, ",") {
+			placeholders = append(placeholders, fmt.Sprintf("<node-%s-via-%s>", strings.TrimSpace(reqNode), jbAlias))
+		}
+		return placeholders, sockPath, nil
 	}
 
 	var out bytes.Buffer
@@ -154,12 +127,17 @@ func RunCapture(hosts []string, filter, sockPath string, cfg *Config) error {
 	// 1. Create a Named Pipe (FIFO) for each host
 	for i, host := range hosts {
 		fifoPath := filepath.Join(os.TempDir(), fmt.Sprintf("wssh_cap_%s_%d.pcap", host, i))
-		os.Remove(fifoPath) // Clean up just in case an old one is stuck
-		
-		if err := syscall.Mkfifo(fifoPath, 0600); err != nil {
-			return fmt.Errorf("failed to create fifo for %s: %v", host, err)
+
+		if dryRun != nil {
+			dryRun.record(PlanStep{Kind: "mkfifo", Argv: []string{"mkfifo", "-m", "600", fifoPath}})
+		} else {
+			os.Remove(fifoPath) // Clean up just in case an old one is stuck
+
+			if err := syscall.Mkfifo(fifoPath, 0600); err != nil {
+				return fmt.Errorf("failed to create fifo for %s: %v", host, err)
+			}
+			fifos = append(fifos, fifoPath)
 		}
-		fifos = append(fifos, fifoPath)
 		
 		// Tell Wireshark to listen to this pipe
 		wiresharkArgs = append(wiresharkArgs, "-i", fifoPath)
@@ -168,25 +146,29 @@ func RunCapture(hosts []string, filter, sockPath string, cfg *Config) error {
 	// 2. Start Wireshark FIRST (It must be running to open the read-end of the pipes)
 	fmt.Printf("🦈 Launching Wireshark for %d host(s)...\n", len(hosts))
 	wsCmd := exec.Command("wireshark", wiresharkArgs...)
-	if err := wsCmd.Start(); err != nil {
+	if err := startCommand(wsCmd, "runs until the Wireshark window is closed"); err != nil {
 		return fmt.Errorf("failed to start wireshark (ensure it is in your PATH): %v", err)
 	}
 
 	// 3. Start the parallel SSH streams
 	for i, host := range hosts {
 		remoteCmd := fmt.Sprintf("sudo tcpdump -U -w - %s", filter)
-		sshArgs := []string{"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null", host, remoteCmd}
-		
-		cmd := exec.Command("ssh", sshArgs...)
+		sshCmd := NewSSH(cfg.LookupHost(host), cfg, remoteCmd)
 
 		// Inject the exact same socket we used for the jumpbox!
 		if sockPath != "" {
-			cmd.Env = os.Environ()
-			cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", sockPath))
+			sshCmd.AgentSock = sockPath
+		}
+		cmd := sshCmd.Cmd()
+
+		fifoPath := filepath.Join(os.TempDir(), fmt.Sprintf("wssh_cap_%s_%d.pcap", host, i))
+		if dryRun != nil {
+			startCommand(cmd, "stdout -> "+fifoPath)
+			continue
 		}
 
 		// Open the pipe for writing...
-		pipeFile, err := os.OpenFile(fifos[i], os.O_WRONLY, 0600)
+		pipeFile, err := os.OpenFile(fifoPath, os.O_WRONLY, 0600)
 		if err != nil {
 			fmt.Printf("Warning: failed to open pipe for %s: %v\n", host, err)
 			continue
@@ -202,6 +184,9 @@ func RunCapture(hosts []string, filter, sockPath string, cfg *Config) error {
 	}
 
 	// 4. Block and wait for you to close the Wireshark GUI
+	if dryRun != nil {
+		return nil
+	}
 	wsCmd.Wait()
 	fmt.Println("🛑 Wireshark closed. Cleaning up SSH streams and pipes...")
 	return nil
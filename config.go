@@ -2,114 +2,200 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"strings"
-
-	"gopkg.in/yaml.v3"
 )
 
 // --- YAML Data Structures ---
 
+// PaneCommand overrides what a single pane of a layout runs. Both fields are optional.
+type PaneCommand struct {
+	Host    string `yaml:"host,omitempty"`    // Alias to connect to instead of the launched host
+	Command string `yaml:"command,omitempty"` // Remote command template, e.g. "tail -f /var/log/{alias}.log"
+}
+
+// Row is one horizontal strip of a layout. Panes are placed left to right.
 type Row struct {
-	Panes int `yaml:"panes"`
+	Panes    int           `yaml:"panes"`
+	Size     int           `yaml:"size,omitempty"`     // Relative height of this row (default 1)
+	Sizes    []int         `yaml:"sizes,omitempty"`    // Relative width of each pane in the row
+	Commands []PaneCommand `yaml:"commands,omitempty"` // Per-pane overrides, in pane order
 }
 
+// Layout describes a tab as rows stacked top to bottom
 type Layout struct {
-	Description string `yaml:"description"`
+	Description string `yaml:"description,omitempty"`
 	Rows        []Row  `yaml:"rows"`
 }
 
+// SSHSettings are connection options that can be set on a group and overridden per host
+type SSHSettings struct {
+	User         string            `yaml:"user,omitempty"`
+	Port         int               `yaml:"port,omitempty"`
+	IdentityFile string            `yaml:"identity_file,omitempty"`
+	Jump         string            `yaml:"jump,omitempty"`        // ProxyJump target, may be an inventory alias
+	SSHOptions   map[string]string `yaml:"ssh_options,omitempty"` // Extra -o Key=Value options
+	AgentEnv     string            `yaml:"agent_env,omitempty"`   // Name of the ssh_agent_envs entry to use
+}
+
 type Host struct {
-	Alias    string   `yaml:"alias"`
-	Hostname string   `yaml:"hostname"`
-	Tags     []string `yaml:"tags"`
+	Alias       string   `yaml:"alias"`
+	Hostname    string   `yaml:"hostname"`
+	Tags        []string `yaml:"tags,omitempty"`
+	Notes       string   `yaml:"notes,omitempty"` // Free text shown in the TUI detail pane
+	SSHSettings `yaml:",inline"`
 }
 
 type Group struct {
-	Name    string   `yaml:"name"`
-	Tags    []string `yaml:"tags,omitempty"`
-	Profile string   `yaml:"profile,omitempty"`
-	LogSession bool     `yaml:"log_session,omitempty"`
-	Hosts   []Host   `yaml:"hosts"`
+	Name        string   `yaml:"name"`
+	Tags        []string `yaml:"tags,omitempty"`
+	Profile     string   `yaml:"profile,omitempty"`
+	LogSession  bool     `yaml:"log_session,omitempty"`
+	SSHSettings `yaml:",inline"`
+	Hosts       []Host `yaml:"hosts"`
 }
 
 // Config represents the entire ~/.wssh.yaml file
 type AgentEnv struct {
 	Sock string `yaml:"sock"`
 	Key  string `yaml:"key"`
+
+	// Match rules. An env without any rules matches aliases starting with its name.
+	Match    []string `yaml:"match,omitempty"`    // Alias globs, or regexes written as /.../
+	Groups   []string `yaml:"groups,omitempty"`   // Group names
+	Tags     []string `yaml:"tags,omitempty"`     // Host or group tags
+	Priority int      `yaml:"priority,omitempty"` // Higher wins when several envs match
 }
 
 type Settings struct {
-	AgentExpirationHours float64             `yaml:"agent_expiration_hours"`
-	AuthCheckEnv         string              `yaml:"auth_check_env"`
-	IgnoreKeyChanges     *bool               `yaml:"ignore_key_changes"`	
-	SSHAgentEnvs         map[string]AgentEnv `yaml:"ssh_agent_envs"`
-	CaptureCommand       string              `yaml:"capture_command"`
+	AgentExpirationHours float64             `yaml:"agent_expiration_hours,omitempty"`
+	AuthCheckEnv         string              `yaml:"auth_check_env,omitempty"`
+	IgnoreKeyChanges     *bool               `yaml:"ignore_key_changes,omitempty"`
+	SSHAgentEnvs         map[string]AgentEnv `yaml:"ssh_agent_envs,omitempty"`
+	CaptureCommand       string              `yaml:"capture_command,omitempty"`
+	Terminal             string              `yaml:"terminal,omitempty"`        // auto (default), iterm or tmux
+	ConnectMode          string              `yaml:"connect_mode,omitempty"`    // tab (default) or inline for single sessions
+	TileLayout           string              `yaml:"tile_layout,omitempty"`     // Default for connect --layout
+	TileMaxPanes         int                 `yaml:"tile_max_panes,omitempty"`  // Panes per tab in "auto" mode
+	BackupDir            string              `yaml:"backup_dir,omitempty"`      // Where config backups go (default ~/.wssh_backups)
+	BackupKeep           int                 `yaml:"backup_keep,omitempty"`     // Backups to keep (default 20)
+	SSHConfigMode        string              `yaml:"ssh_config_mode,omitempty"` // block (default) or include, see sync-ssh-config
 }
 
 type Config struct {
-	Settings Settings               `yaml:"settings,omitempty"`
-	Payloads map[string]string      `yaml:"payloads"`
-	Layouts  map[string]interface{} `yaml:"layouts,omitempty"`
-	Macros   map[string]string      `yaml:"macros,omitempty"`
-	Groups   []Group                `yaml:"groups"`
+	Include  []string          `yaml:"include,omitempty"` // Extra files to merge in, globs relative to this file
+	Settings Settings          `yaml:"settings,omitempty"`
+	Payloads map[string]string `yaml:"payloads,omitempty"`
+	Layouts  map[string]Layout `yaml:"layouts,omitempty"`
+	Macros   map[string]string `yaml:"macros,omitempty"`
+	Groups   []Group           `yaml:"groups"`
+
+	path     string            // Main file the config was loaded from, where edits are written back
+	files    []string          // Every file merged in, in order
+	origins  map[string]string // File each merged value came from, e.g. "macros.disk"
+	warnings []string          // Problems found while merging the files
 }
 
 // --- Application Data Structures ---
 type SearchableHost struct {
-	Alias       string
-	Hostname    string
-	GroupName   string
-	SearchIndex string
-	Profile     string
-	LogSession  bool
+	Alias      string
+	Hostname   string
+	GroupName  string
+	Tags       []string // Group tags followed by host tags
+	Profile    string
+	LogSession bool
+	Notes      string
+	SSH        SSHSettings // Group settings with the host's overrides applied
 }
 
 // SearchableHost is the flattened struct we will pass to the TUI for fuzzy finding.
 
-// LoadConfig reads the YAML file, parses it, and builds the flat search index.
+// LoadConfig reads the YAML file and its includes, merges them, and builds the flat search index.
 func LoadConfig(path string) (*Config, []SearchableHost, error) {
-	// 1. Read the raw file
-	data, err := os.ReadFile(path)
+	// 1. Read the main file
+	main, err := readConfigFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. Merge in the included files (see include.go for the rules)
+	files, err := includedFiles(path, main.Include)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, err
 	}
 
-	// 2. Unmarshal YAML into our Go struct
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, nil, fmt.Errorf("failed to parse yaml: %w", err)
+	cfg := &Config{path: path, Include: main.Include}
+	cfg.merge(main, path)
+	for _, file := range files {
+		part, err := readConfigFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", file, err)
+		}
+		cfg.merge(part, file)
 	}
 
 	// 3. Build the flattened search index
+	return cfg, buildSearchableHosts(cfg), nil
+}
+
+// buildSearchableHosts flattens the groups into the list the TUI and search use
+func buildSearchableHosts(cfg *Config) []SearchableHost {
 	var searchableHosts []SearchableHost
 
 	for _, group := range cfg.Groups {
 		for _, host := range group.Hosts {
-			// Combine group tags, host tags, the group name, and the host alias.
-			// This ensures typing *any* of these words will match the host.
-			allKeywords := append([]string{group.Name, host.Alias, host.Hostname}, group.Tags...)
-			allKeywords = append(allKeywords, host.Tags...)
+			searchableHosts = append(searchableHosts, SearchableHost{
+				Alias:      host.Alias,
+				Hostname:   host.Hostname,
+				GroupName:  group.Name,
+				Tags:       append(append([]string{}, group.Tags...), host.Tags...),
+				Profile:    group.Profile,
+				LogSession: group.LogSession,
+				Notes:      host.Notes,
+				SSH:        mergeSSHSettings(group.SSHSettings, host.SSHSettings),
+			})
+		}
+	}
 
-			// Convert everything to lowercase to make searching case-insensitive
-			for i, word := range allKeywords {
-				allKeywords[i] = strings.ToLower(word)
-			}
+	return searchableHosts
+}
 
-			// Join them into a single space-separated string:
-			// e.g., "development web-dev-uswest-01 dev sandbox us-west cluster-a web"
-			searchIndex := strings.Join(allKeywords, " ")
+// mergeSSHSettings applies the host's connection settings on top of its group's
+func mergeSSHSettings(group, host SSHSettings) SSHSettings {
+	merged := group
+	if host.User != "" {
+		merged.User = host.User
+	}
+	if host.Port != 0 {
+		merged.Port = host.Port
+	}
+	if host.IdentityFile != "" {
+		merged.IdentityFile = host.IdentityFile
+	}
+	if host.Jump != "" {
+		merged.Jump = host.Jump
+	}
+	if host.AgentEnv != "" {
+		merged.AgentEnv = host.AgentEnv
+	}
 
-			searchableHosts = append(searchableHosts, SearchableHost{
-				Alias:       host.Alias,
-				Hostname:    host.Hostname,
-				GroupName:   group.Name,
-				SearchIndex: searchIndex,
-				Profile:     group.Profile,
-				LogSession:  group.LogSession,
-			})
+	if len(group.SSHOptions) > 0 || len(host.SSHOptions) > 0 {
+		merged.SSHOptions = make(map[string]string)
+		for k, v := range group.SSHOptions {
+			merged.SSHOptions[k] = v
+		}
+		for k, v := range host.SSHOptions {
+			merged.SSHOptions[k] = v
 		}
 	}
+	return merged
+}
 
-	return &cfg, searchableHosts, nil
+// LookupHost finds a host by alias. Unknown aliases are returned as ad-hoc hosts
+// so ssh can still resolve them through ~/.ssh/config.
+func (cfg *Config) LookupHost(alias string) SearchableHost {
+	for _, h := range buildSearchableHosts(cfg) {
+		if h.Alias == alias {
+			return h
+		}
+	}
+	return SearchableHost{Alias: alias}
 }
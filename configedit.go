@@ -0,0 +1,544 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFile is a config file as a YAML node tree. Commands that change the
+// config edit only the nodes they touch and save the tree back, so comments,
+// key order and quoting everywhere else in the file survive.
+type ConfigFile struct {
+	Path string
+	raw  []byte // Contents when opened, used to restore formatting yaml.v3 drops
+	doc  yaml.Node
+}
+
+// OpenConfigFile parses the config for editing. A missing file is an empty config.
+func OpenConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	f := &ConfigFile{Path: path, raw: data}
+	if err := yaml.Unmarshal(data, &f.doc); err != nil {
+		return nil, fmt.Errorf("failed to parse yaml: %w", err)
+	}
+	if len(f.doc.Content) == 0 {
+		f.doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if f.root().Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: top level must be a mapping", path)
+	}
+	return f, nil
+}
+
+func (f *ConfigFile) root() *yaml.Node {
+	return f.doc.Content[0]
+}
+
+// AddHost appends a host to the named group (matched case-insensitively),
+// creating the group at the end of the file if it doesn't exist yet
+func (f *ConfigFile) AddHost(groupName string, host Host) error {
+	var n yaml.Node
+	if err := n.Encode(host); err != nil {
+		return err
+	}
+
+	// Style it like the last host of the group, or of the last group for a new one
+	like := f.findGroup(groupName)
+	if groups := mappingValue(f.root(), "groups"); like == nil && groups != nil {
+		like = sequenceItem(groups, len(groups.Content)-1)
+	}
+	if hosts := mappingValue(like, "hosts"); hosts != nil {
+		styleLike(&n, sequenceItem(hosts, len(hosts.Content)-1))
+	}
+	return f.InsertHost(groupName, &n)
+}
+
+// InsertHost appends a host node, e.g. one taken out with RemoveHost, to the
+// named group, creating the group if needed
+func (f *ConfigFile) InsertHost(groupName string, host *yaml.Node) error {
+	group, err := f.ensureGroup(groupName)
+	if err != nil {
+		return err
+	}
+	hosts, err := f.ensureSequence(group, "hosts")
+	if err != nil {
+		return fmt.Errorf("group '%s': %v", groupName, err)
+	}
+	hosts.Content = append(hosts.Content, host)
+	return nil
+}
+
+// ensureGroup returns the named group, adding an empty one at the end if needed
+func (f *ConfigFile) ensureGroup(name string) (*yaml.Node, error) {
+	groups, err := f.ensureSequence(f.root(), "groups")
+	if err != nil {
+		return nil, err
+	}
+	if g := f.findGroup(name); g != nil {
+		return g, nil
+	}
+
+	var n yaml.Node
+	if err := n.Encode(Group{Name: name}); err != nil {
+		return nil, err
+	}
+	styleLike(&n, sequenceItem(groups, len(groups.Content)-1))
+	groups.Content = append(groups.Content, &n)
+	return &n, nil
+}
+
+// findGroup returns the mapping node of the named group, or nil
+func (f *ConfigFile) findGroup(name string) *yaml.Node {
+	groups := mappingValue(f.root(), "groups")
+	if groups == nil || groups.Kind != yaml.SequenceNode {
+		return nil
+	}
+	for _, g := range groups.Content {
+		if n := mappingValue(g, "name"); n != nil && strings.EqualFold(n.Value, name) {
+			return g
+		}
+	}
+	return nil
+}
+
+// findHost returns the mapping node of a host and the hosts list holding it, or nils
+func (f *ConfigFile) findHost(alias string) (host, hosts *yaml.Node) {
+	groups := mappingValue(f.root(), "groups")
+	if groups == nil || groups.Kind != yaml.SequenceNode {
+		return nil, nil
+	}
+	for _, g := range groups.Content {
+		list := mappingValue(g, "hosts")
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, h := range list.Content {
+			if a := mappingValue(h, "alias"); a != nil && a.Value == alias {
+				return h, list
+			}
+		}
+	}
+	return nil, nil
+}
+
+// RemoveHost takes a host out of its group and returns its node, or nil if
+// this file doesn't define it
+func (f *ConfigFile) RemoveHost(alias string) *yaml.Node {
+	host, hosts := f.findHost(alias)
+	if host == nil {
+		return nil
+	}
+	for i, h := range hosts.Content {
+		if h == host {
+			hosts.Content = append(hosts.Content[:i], hosts.Content[i+1:]...)
+			break
+		}
+	}
+	return host
+}
+
+// RemoveGroup deletes a group with its hosts, reporting whether the file defined it
+func (f *ConfigFile) RemoveGroup(name string) bool {
+	group := f.findGroup(name)
+	if group == nil {
+		return false
+	}
+	groups := mappingValue(f.root(), "groups")
+	for i, g := range groups.Content {
+		if g == group {
+			groups.Content = append(groups.Content[:i], groups.Content[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// RenameHost changes an alias, along with the jump settings and layout panes
+// that refer to it. It reports whether anything in the file changed.
+func (f *ConfigFile) RenameHost(oldAlias, newAlias string) bool {
+	changed := false
+	if host, _ := f.findHost(oldAlias); host != nil {
+		mappingValue(host, "alias").Value = newAlias
+		changed = true
+	}
+
+	renameJump := func(n *yaml.Node) {
+		jump := mappingValue(n, "jump")
+		if jump == nil || jump.Kind != yaml.ScalarNode {
+			return
+		}
+		hops := strings.Split(jump.Value, ",")
+		for i, hop := range hops {
+			if strings.TrimSpace(hop) == oldAlias {
+				hops[i] = strings.Replace(hop, oldAlias, newAlias, 1)
+				changed = true
+			}
+		}
+		jump.Value = strings.Join(hops, ",")
+	}
+	if groups := mappingValue(f.root(), "groups"); groups != nil {
+		for _, g := range groups.Content {
+			renameJump(g)
+			if hosts := mappingValue(g, "hosts"); hosts != nil {
+				for _, h := range hosts.Content {
+					renameJump(h)
+				}
+			}
+		}
+	}
+
+	if layouts := mappingValue(f.root(), "layouts"); layouts != nil && layouts.Kind == yaml.MappingNode {
+		for i := 1; i < len(layouts.Content); i += 2 {
+			rows := mappingValue(layouts.Content[i], "rows")
+			if rows == nil {
+				continue
+			}
+			for _, row := range rows.Content {
+				commands := mappingValue(row, "commands")
+				if commands == nil {
+					continue
+				}
+				for _, c := range commands.Content {
+					if h := mappingValue(c, "host"); h != nil && h.Value == oldAlias {
+						h.Value = newAlias
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// RenameGroup changes a group's name, along with the agent env rules that
+// refer to it. It reports whether anything in the file changed.
+func (f *ConfigFile) RenameGroup(oldName, newName string) bool {
+	changed := false
+	if group := f.findGroup(oldName); group != nil {
+		mappingValue(group, "name").Value = newName
+		changed = true
+	}
+
+	envs := mappingValue(mappingValue(f.root(), "settings"), "ssh_agent_envs")
+	if envs != nil && envs.Kind == yaml.MappingNode {
+		for i := 1; i < len(envs.Content); i += 2 {
+			if groups := mappingValue(envs.Content[i], "groups"); groups != nil {
+				for _, g := range groups.Content {
+					if strings.EqualFold(g.Value, oldName) {
+						g.Value = newName
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// ensureSequence returns the block sequence stored under key, adding an empty one if needed
+func (f *ConfigFile) ensureSequence(parent *yaml.Node, key string) (*yaml.Node, error) {
+	seq := mappingValue(parent, key)
+	if seq == nil || (seq.Kind == yaml.ScalarNode && seq.Tag == "!!null") {
+		seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		setMappingValue(parent, key, seq)
+	}
+	if seq.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("'%s' must be a list", key)
+	}
+	seq.Style &^= yaml.FlowStyle // "hosts: []" grows into a block list
+	return seq, nil
+}
+
+// Bytes encodes the tree. yaml.v3 drops blank lines and re-indents comments,
+// so lines that did not change are taken verbatim from the original file.
+func (f *ConfigFile) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(detectIndent(f.raw))
+	if err := enc.Encode(&f.doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return restoreFormatting(f.raw, buf.Bytes()), nil
+}
+
+// Save writes the edited config back to its file, keeping a backup of the old version
+func (f *ConfigFile) Save(reason string) error {
+	data, err := f.Bytes()
+	if err != nil {
+		return err
+	}
+	backupDir, keep := backupSettings(f.settings())
+	if err := commitWrites(backupDir, keep, reason, fileWrite{Path: f.Path, Data: data, Perm: 0644}); err != nil {
+		return err
+	}
+	f.raw = data
+	return nil
+}
+
+// settings decodes the settings section, e.g. for the backup location
+func (f *ConfigFile) settings() Settings {
+	var s Settings
+	if n := mappingValue(f.root(), "settings"); n != nil {
+		n.Decode(&s)
+	}
+	return s
+}
+
+// detectIndent returns the indentation the file already uses (2 if unknown)
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if n := len(line) - len(trimmed); n > 0 {
+			if n > 8 {
+				break
+			}
+			return n
+		}
+	}
+	return 2
+}
+
+// restoreFormatting takes the encoder output and puts back the original text of
+// every unchanged line, along with the blank lines that preceded it
+func restoreFormatting(original, encoded []byte) []byte {
+	if len(bytes.TrimSpace(original)) == 0 {
+		return encoded
+	}
+
+	origLines, origBlanks := splitBlankLines(original)
+	encLines, encBlanks := splitBlankLines(encoded)
+
+	var out strings.Builder
+	emit := func(blanks int, line string) {
+		out.WriteString(strings.Repeat("\n", blanks))
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+
+	// A run of removed lines hands the blank lines in front of it to the line
+	// that takes its place, so the spacing around an edit stays where it was
+	i, j, carry := 0, 0, -1
+	blanksBefore := func(orig int) int {
+		if carry >= 0 {
+			orig, carry = carry, -1
+		}
+		return orig
+	}
+	for _, op := range diffLines(origLines, encLines, sameYAMLLine) {
+		switch op.Kind {
+		case diffEqual:
+			emit(max(blanksBefore(origBlanks[i]), encBlanks[j]), op.A)
+			i++
+			j++
+		case diffDelete:
+			if carry < 0 {
+				carry = origBlanks[i]
+			}
+			i++
+		case diffInsert:
+			emit(max(blanksBefore(0), encBlanks[j]), op.B)
+			j++
+		}
+	}
+	out.WriteString(strings.Repeat("\n", max(blanksBefore(origBlanks[i]), encBlanks[j])))
+	return []byte(out.String())
+}
+
+// sameYAMLLine reports whether an original line and an encoded line say the same
+// thing. The encoder re-indents comment lines and writes a single space before
+// inline comments, so those differences are ignored; any other difference,
+// spacing inside a value included, is an edit.
+func sameYAMLLine(orig, enc string) bool {
+	if orig == enc {
+		return true
+	}
+	to, te := strings.TrimSpace(orig), strings.TrimSpace(enc)
+	if strings.HasPrefix(to, "#") {
+		return to == te
+	}
+
+	code, comment, ok := strings.Cut(enc, " #")
+	if !ok || strings.HasSuffix(code, " ") || inQuotes(code) {
+		return false
+	}
+	rest, found := strings.CutPrefix(orig, code)
+	if !found || !strings.HasSuffix(rest, "#"+comment) {
+		return false
+	}
+	spaces := strings.TrimSuffix(rest, "#"+comment)
+	return spaces != "" && strings.Trim(spaces, " \t") == ""
+}
+
+// inQuotes reports whether the end of a line is inside a quoted string, which
+// means a # there is text and not a comment. Unsure cases count as quoted.
+func inQuotes(s string) bool {
+	return strings.Count(s, "'")%2 == 1 || (strings.Count(s, `"`)-strings.Count(s, `\"`))%2 == 1
+}
+
+// splitBlankLines returns the non-blank lines, and for each of them how many
+// blank lines came before it. The extra last count is for the end of the file.
+func splitBlankLines(data []byte) ([]string, []int) {
+	var lines []string
+	var blanks []int
+	count := 0
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			count++
+			continue
+		}
+		lines = append(lines, line)
+		blanks = append(blanks, count)
+		count = 0
+	}
+	return lines, append(blanks, count)
+}
+
+// styleLike copies the quoting of sibling's strings, and its flow or block style
+// for lists, onto a newly encoded node so it blends in with its neighbours
+func styleLike(n, sibling *yaml.Node) {
+	if n == nil || sibling == nil || n.Kind != yaml.MappingNode || sibling.Kind != yaml.MappingNode {
+		return
+	}
+
+	var quoting yaml.Style
+	for i := 1; i < len(sibling.Content); i += 2 {
+		if v := sibling.Content[i]; v.Kind == yaml.ScalarNode && v.Tag == "!!str" {
+			quoting = v.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+			break
+		}
+	}
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		v := n.Content[i+1]
+		switch v.Kind {
+		case yaml.ScalarNode:
+			if v.Tag == "!!str" {
+				v.Style = quoting
+			}
+		case yaml.SequenceNode:
+			if s := mappingValue(sibling, n.Content[i].Value); s != nil && s.Kind == yaml.SequenceNode {
+				v.Style = s.Style & yaml.FlowStyle
+			}
+			for _, item := range v.Content {
+				if item.Kind == yaml.ScalarNode && item.Tag == "!!str" {
+					item.Style = quoting
+				}
+			}
+		}
+	}
+}
+
+// --- yaml.Node helpers ---
+
+// mappingKey returns the key node for key in a mapping node, or nil
+func mappingKey(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value node for key in a mapping node, or nil
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue replaces the value for key, appending the key if it is missing
+func setMappingValue(n *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content[i+1] = value
+			return
+		}
+	}
+	n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// setScalar sets key to a scalar value. An existing value keeps its quoting,
+// a new key is quoted like the other strings of the mapping.
+func setScalar(n *yaml.Node, key, value, tag string) {
+	if v := mappingValue(n, key); v != nil && v.Kind == yaml.ScalarNode {
+		v.Value, v.Tag = value, tag
+		if tag != "!!str" {
+			v.Style = 0
+		}
+		return
+	}
+
+	v := &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+	if tag == "!!str" {
+		for i := 1; i < len(n.Content); i += 2 {
+			if s := n.Content[i]; s.Kind == yaml.ScalarNode && s.Tag == "!!str" {
+				v.Style = s.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+				break
+			}
+		}
+	}
+	insertMappingValue(n, key, v)
+}
+
+// insertMappingValue sets key, adding a missing key in front of a group's
+// hosts list so the settings stay above the hosts
+func insertMappingValue(n *yaml.Node, key string, value *yaml.Node) {
+	if mappingKey(n, key) != nil {
+		setMappingValue(n, key, value)
+		return
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == "hosts" {
+			k := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+			n.Content = append(n.Content[:i], append([]*yaml.Node{k, value}, n.Content[i:]...)...)
+			return
+		}
+	}
+	setMappingValue(n, key, value)
+}
+
+// deleteMappingKey removes key from a mapping node, reporting whether it was there
+func deleteMappingKey(n *yaml.Node, key string) bool {
+	if n == nil || n.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			n.Content = append(n.Content[:i], n.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// sequenceItem returns the i-th item of a sequence node, or nil
+func sequenceItem(n *yaml.Node, i int) *yaml.Node {
+	if n == nil || n.Kind != yaml.SequenceNode || i < 0 || i >= len(n.Content) {
+		return nil
+	}
+	return n.Content[i]
+}
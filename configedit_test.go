@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/")
+
+// checkGolden compares got with testdata/configedit/<name>, or rewrites it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "configedit", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the golden file:\n%s", name, unifiedDiff(path, "got", want, got))
+	}
+}
+
+// TestConfigFileEdits checks that edits only change the lines they touch, and
+// that the comments, blank lines, key order and quoting of the rest survive
+func TestConfigFileEdits(t *testing.T) {
+	tests := []struct {
+		name   string
+		golden string
+		edit   func(t *testing.T, f *ConfigFile)
+	}{
+		{
+			name:   "add host",
+			golden: "add_host.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				if err := f.AddHost("databases", Host{Alias: "db-03", Hostname: "10.1.0.3", Tags: []string{"pg"}}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:   "add host to a new group",
+			golden: "add_group.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				if err := f.AddHost("web", Host{Alias: "web-01", Hostname: "10.2.0.1"}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			name:   "remove host",
+			golden: "remove_host.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				if f.RemoveHost("db-01") == nil {
+					t.Fatal("db-01 not found")
+				}
+			},
+		},
+		{
+			name:   "rename host",
+			golden: "rename_host.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				if !f.RenameHost("db-02", "db-replica") {
+					t.Fatal("nothing renamed")
+				}
+			},
+		},
+		{
+			name:   "rename jump host",
+			golden: "rename_jump.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				if !f.RenameHost("bastion", "gateway") {
+					t.Fatal("nothing renamed")
+				}
+			},
+		},
+		{
+			name:   "change a line after a blank line",
+			golden: "edit_after_blank.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				host, _ := f.findHost("db-02")
+				setScalar(host, "hostname", "10.1.0.12", "!!str")
+			},
+		},
+		{
+			name:   "spacing inside a value",
+			golden: "value_spacing.golden",
+			edit: func(t *testing.T, f *ConfigFile) {
+				host, _ := f.findHost("db-02")
+				setScalar(host, "notes", "rebuilt 2026-03, keep the spacing", "!!str")
+			},
+		},
+	}
+
+	source := filepath.Join("testdata", "configedit", "commented.yaml")
+	t.Run("no edits", func(t *testing.T) {
+		f, err := OpenConfigFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(f.raw) {
+			t.Errorf("saving without edits changed the file:\n%s", unifiedDiff(source, "got", f.raw, got))
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := OpenConfigFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(t, f)
+			got, err := f.Bytes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.golden, got)
+		})
+	}
+}
+
+func TestSameYAMLLine(t *testing.T) {
+	tests := []struct {
+		orig, enc string
+		want      bool
+	}{
+		{"  alias: db-01", "  alias: db-01", true},
+		{"      # primary databases", "    # primary databases", true},
+		{"  port: 2222     # not 22", "  port: 2222 # not 22", true},
+		{"  port: 2222\t# not 22", "  port: 2222 # not 22", true},
+		{"  port: 2222  # not 22", "  port: 2223 # not 22", false},
+		{"  port: 2222  # not 22", "  port: 2222 # not 23", false},
+		{"  port: 2222", "    port: 2222", false},
+		{`  notes: "a  b"`, `  notes: "a b"`, false},
+		{"  notes: a  b", "  notes: a b", false},
+		{`  notes: "a   # b"`, `  notes: "a # b"`, false},
+		{"  notes: it's  # fine", "  notes: it's # fine", false},
+		{"  alias: db-01", "  alias: db-01 # new comment", false},
+	}
+	for _, tt := range tests {
+		if got := sameYAMLLine(tt.orig, tt.enc); got != tt.want {
+			t.Errorf("sameYAMLLine(%q, %q) = %v, want %v", tt.orig, tt.enc, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// envConfig overrides the config location, like --config
+const envConfig = "WSSH_CONFIG"
+
+// defaultContext is the config used when no named context is active
+const defaultContext = "default"
+
+// validContextName keeps context names usable as file names
+var validContextName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ConfigLocation is the config file wssh uses and how it was chosen
+type ConfigLocation struct {
+	Path    string
+	Context string // Named context the file belongs to, empty for the default config
+	Source  string // --config, WSSH_CONFIG, context, xdg or home
+}
+
+// ResolveConfigLocation picks the config file. The order is:
+//  1. the --config flag
+//  2. the WSSH_CONFIG environment variable
+//  3. the active named context ($XDG_CONFIG_HOME/wssh/contexts/<name>.yaml)
+//  4. $XDG_CONFIG_HOME/wssh/config.yaml, if it exists
+//  5. ~/.wssh.yaml
+//
+// New installs get ~/.wssh.yaml unless XDG_CONFIG_HOME is set.
+func ResolveConfigLocation(flag string) (ConfigLocation, error) {
+	if flag != "" {
+		return ConfigLocation{Path: absPath(flag), Source: "--config"}, nil
+	}
+	if env := os.Getenv(envConfig); env != "" {
+		return ConfigLocation{Path: absPath(env), Source: envConfig}, nil
+	}
+	if name := CurrentContext(); name != defaultContext {
+		return ConfigLocation{Path: contextPath(name), Context: name, Source: "context"}, nil
+	}
+
+	xdgPath := filepath.Join(configDir(), "config.yaml")
+	if _, err := os.Stat(xdgPath); err == nil {
+		return ConfigLocation{Path: xdgPath, Source: "xdg"}, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ConfigLocation{}, fmt.Errorf("could not determine home directory: %v", err)
+	}
+	homePath := filepath.Join(homeDir, ".wssh.yaml")
+	if _, err := os.Stat(homePath); os.IsNotExist(err) && os.Getenv("XDG_CONFIG_HOME") != "" {
+		return ConfigLocation{Path: xdgPath, Source: "xdg"}, nil
+	}
+	return ConfigLocation{Path: homePath, Source: "home"}, nil
+}
+
+// configDir is $XDG_CONFIG_HOME/wssh, ~/.config/wssh by default
+func configDir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		homeDir, _ := os.UserHomeDir()
+		base = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(base, "wssh")
+}
+
+func contextsDir() string {
+	return filepath.Join(configDir(), "contexts")
+}
+
+func contextPath(name string) string {
+	return filepath.Join(contextsDir(), name+".yaml")
+}
+
+// contextStateFile holds the name of the active context
+func contextStateFile() string {
+	return filepath.Join(configDir(), "current-context")
+}
+
+// CurrentContext returns the active context, "default" when none is set
+func CurrentContext() string {
+	data, err := os.ReadFile(contextStateFile())
+	if err != nil {
+		return defaultContext
+	}
+	name := strings.TrimSpace(string(data))
+	if name == "" || !validContextName.MatchString(name) {
+		return defaultContext
+	}
+	return name
+}
+
+// ListContexts returns "default" followed by the named contexts, sorted
+func ListContexts() []string {
+	names := []string{defaultContext}
+	matches, _ := filepath.Glob(filepath.Join(contextsDir(), "*.yaml"))
+	sort.Strings(matches)
+	for _, m := range matches {
+		if name := strings.TrimSuffix(filepath.Base(m), ".yaml"); name != defaultContext {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// UseContext makes name the active context
+func UseContext(name string) error {
+	if name != defaultContext {
+		if _, err := os.Stat(contextPath(name)); err != nil {
+			return fmt.Errorf("context '%s' does not exist (create it with 'wssh context create %s')", name, name)
+		}
+	}
+
+	if dryRun != nil {
+		dryRun.record(PlanStep{Kind: "write_file", Path: contextStateFile(), Note: "switch to context " + name})
+		return nil
+	}
+	if name == defaultContext {
+		if err := os.Remove(contextStateFile()); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return writeFileAtomic(contextStateFile(), []byte(name+"\n"), 0644)
+}
+
+// CreateContext writes a new context, a copy of copyFrom or else the starter config
+func CreateContext(name, copyFrom string) (string, error) {
+	if name == defaultContext || !validContextName.MatchString(name) {
+		return "", fmt.Errorf("invalid context name '%s'", name)
+	}
+	path := contextPath(name)
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("context '%s' already exists at %s", name, path)
+	}
+
+	if copyFrom == "" {
+		return path, generateDefaultConfig(path)
+	}
+	data, err := os.ReadFile(copyFrom)
+	if err != nil {
+		return "", err
+	}
+	return path, writeConfigFile(path, string(data))
+}
+
+// PrintContexts lists the contexts, marking the active one
+func PrintContexts() {
+	current := CurrentContext()
+	for _, name := range ListContexts() {
+		marker := " "
+		if name == current {
+			marker = "*"
+		}
+		path := contextPath(name)
+		if name == defaultContext {
+			path = "(~/.wssh.yaml or $XDG_CONFIG_HOME/wssh/config.yaml)"
+		}
+		fmt.Printf("%s %-15s %s\n", marker, name, shortPath(path))
+	}
+}
+
+func absPath(path string) string {
+	path = expandPath(path)
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
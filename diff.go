@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line diffs, used to keep the untouched parts of files we rewrite byte for byte
+// and to preview changes before writing them
+
+// Diff operations
+const (
+	diffEqual = iota
+	diffDelete
+	diffInsert
+)
+
+// diffOp is one line of a diff. For diffEqual, A and B are the old and new
+// text, which may differ in ways the equality function ignores.
+type diffOp struct {
+	Kind int
+	A, B string
+}
+
+// diffLines returns the shortest edit script turning a into b. The common
+// prefix and suffix are matched first, so small edits to large files stay cheap.
+func diffLines(a, b []string, equal func(x, y string) bool) []diffOp {
+	var head, tail []diffOp
+	for len(a) > 0 && len(b) > 0 && equal(a[0], b[0]) {
+		head = append(head, diffOp{Kind: diffEqual, A: a[0], B: b[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && equal(a[len(a)-1], b[len(b)-1]) {
+		tail = append([]diffOp{{Kind: diffEqual, A: a[len(a)-1], B: b[len(b)-1]}}, tail...)
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	// Longest common subsequence of what is left
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if equal(a[i], b[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := head
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case equal(a[i], b[j]):
+			ops = append(ops, diffOp{Kind: diffEqual, A: a[i], B: b[j]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{Kind: diffDelete, A: a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{Kind: diffInsert, B: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{Kind: diffDelete, A: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{Kind: diffInsert, B: b[j]})
+	}
+	return append(ops, tail...)
+}
+
+// unifiedDiff renders the changes from a to b as a unified diff with three
+// lines of context, or "" when they are the same
+func unifiedDiff(nameA, nameB string, a, b []byte) string {
+	linesA := splitLines(a)
+	linesB := splitLines(b)
+	ops := diffLines(linesA, linesB, func(x, y string) bool { return x == y })
+
+	const context = 3
+	var out strings.Builder
+
+	// Walk the ops, tracking line numbers, and emit each run of changes with its context
+	i := 0
+	for i < len(ops) {
+		if ops[i].Kind == diffEqual {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are closer than 2*context lines apart
+		start := max(i-context, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != diffEqual {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].Kind == diffEqual {
+				next++
+			}
+			if next == len(ops) || next-end > 2*context {
+				end = min(end+context, len(ops))
+				break
+			}
+			end = next
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		lineA, lineB := 1, 1
+		for _, op := range ops[:start] {
+			if op.Kind != diffInsert {
+				lineA++
+			}
+			if op.Kind != diffDelete {
+				lineB++
+			}
+		}
+		countA, countB := 0, 0
+		for _, op := range ops[start:end] {
+			if op.Kind != diffInsert {
+				countA++
+			}
+			if op.Kind != diffDelete {
+				countB++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", lineA, countA, lineB, countB)
+		for _, op := range ops[start:end] {
+			switch op.Kind {
+			case diffEqual:
+				out.WriteString(" " + op.A + "\n")
+			case diffDelete:
+				out.WriteString("-" + op.A + "\n")
+			case diffInsert:
+				out.WriteString("+" + op.B + "\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// splitLines splits file contents into lines without their newlines
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// PlanStep is one action wssh would have taken if --dry-run wasn't set
+type PlanStep struct {
+	Kind    string   `json:"kind"`               // exec, applescript, mkfifo, log_file...
+	Argv    []string `json:"argv,omitempty"`     // Full argv, program first
+	Env     []string `json:"env,omitempty"`      // Only the variables wssh overrides (e.g. SSH_AUTH_SOCK)
+	Script  string   `json:"script,omitempty"`   // AppleScript source
+	LogFile string   `json:"log_file,omitempty"` // Session log the step writes to
+	Path    string   `json:"path,omitempty"`     // File that would be created or modified
+	Note    string   `json:"note,omitempty"`
+}
+
+// Plan collects the steps of a dry run
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+
+	jsonOut io.Writer // Set with --output json: steps are printed as one document at the end
+}
+
+// dryRun is non-nil while --dry-run is active. Everything that executes a
+// process or touches the filesystem checks it first.
+var dryRun *Plan
+
+// EnableDryRun switches wssh into dry-run mode. With output "json" the regular
+// progress messages are moved to stderr so stdout only carries the plan.
+func EnableDryRun(output string) {
+	dryRun = &Plan{}
+	if output == "json" {
+		dryRun.jsonOut = os.Stdout
+		os.Stdout = os.Stderr
+	}
+}
+
+// FinishDryRun prints the collected plan when JSON output was requested
+func FinishDryRun() error {
+	if dryRun == nil || dryRun.jsonOut == nil {
+		return nil
+	}
+	if dryRun.Steps == nil {
+		dryRun.Steps = []PlanStep{}
+	}
+	enc := json.NewEncoder(dryRun.jsonOut)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dryRun)
+}
+
+// record adds a step to the plan, printing it right away in text mode
+func (p *Plan) record(step PlanStep) {
+	p.Steps = append(p.Steps, step)
+	if p.jsonOut != nil {
+		return
+	}
+
+	switch {
+	case step.Script != "":
+		fmt.Printf("[dry-run] %s:\n%s\n", step.Kind, step.Script)
+	case len(step.Argv) > 0:
+		line := shellJoin(append(append([]string{}, step.Env...), step.Argv...))
+		fmt.Printf("[dry-run] %s: %s\n", step.Kind, line)
+	case step.LogFile != "":
+		fmt.Printf("[dry-run] %s: %s\n", step.Kind, step.LogFile)
+	case step.Path != "":
+		fmt.Printf("[dry-run] %s: %s\n", step.Kind, step.Path)
+	}
+	if step.Note != "" {
+		fmt.Printf("          (%s)\n", step.Note)
+	}
+}
+
+// commandStep describes an exec.Cmd as a plan step
+func commandStep(cmd *exec.Cmd) PlanStep {
+	return PlanStep{Kind: "exec", Argv: cmd.Args, Env: envOverrides(cmd.Env)}
+}
+
+// envOverrides returns the entries of env that differ from our own environment
+func envOverrides(env []string) []string {
+	if env == nil {
+		return nil
+	}
+	inherited := make(map[string]bool)
+	for _, kv := range os.Environ() {
+		inherited[kv] = true
+	}
+
+	var overrides []string
+	for _, kv := range env {
+		if !inherited[kv] {
+			overrides = append(overrides, kv)
+		}
+	}
+	return overrides
+}
+
+// runCommand runs cmd to completion, or only records it in dry-run mode
+func runCommand(cmd *exec.Cmd) error {
+	if dryRun != nil {
+		dryRun.record(commandStep(cmd))
+		return nil
+	}
+	return cmd.Run()
+}
+
+// startCommand starts cmd in the background, or only records it in dry-run mode
+func startCommand(cmd *exec.Cmd, note string) error {
+	if dryRun != nil {
+		step := commandStep(cmd)
+		step.Note = note
+		dryRun.record(step)
+		return nil
+	}
+	return cmd.Start()
+}
@@ -11,14 +11,27 @@ import (
 
 const historyFileName = ".wssh_history"
 
+// layoutsFileName remembers the last layout launched for each host
+const layoutsFileName = ".wssh_layouts"
+
 // LogConnection appends a successful connection to the history file
 func LogConnection(alias string) error {
+	if dryRun != nil {
+		return nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
 	}
 	historyPath := filepath.Join(homeDir, historyFileName)
 
+	// A rename rewrites the file, an entry appended meanwhile would be lost
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Open file in append mode, create it if it doesn't exist
 	f, err := os.OpenFile(historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -121,3 +134,205 @@ func GetRecentHosts() []string {
 	return recent
 }
 
+// renameInHistory rewrites the history entries of an alias, so recent sorting
+// keeps working after a rename. The entries are renamed when the write is
+// committed, under the lock, so connections logged in the meantime are kept.
+// It returns nil when there is no entry to rename yet, and the current count.
+func renameInHistory(oldAlias, newAlias string) (*fileWrite, int, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, 0, err
+	}
+	historyPath := filepath.Join(homeDir, historyFileName)
+
+	data, err := os.ReadFile(historyPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	_, count := renameHistoryEntries(data, oldAlias, newAlias)
+	if count == 0 {
+		return nil, 0, nil
+	}
+
+	build := func() ([]byte, error) {
+		data, err := os.ReadFile(historyPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		renamed, count := renameHistoryEntries(data, oldAlias, newAlias)
+		if count == 0 {
+			return nil, nil
+		}
+		return renamed, nil
+	}
+	return &fileWrite{Path: historyPath, Perm: 0644, Build: build}, count, nil
+}
+
+// renameHistoryEntries returns the history with the entries of oldAlias renamed,
+// and how many there were
+func renameHistoryEntries(data []byte, oldAlias, newAlias string) ([]byte, int) {
+	lines := splitLines(data)
+	count := 0
+	for i, line := range lines {
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) == 2 && parts[1] == oldAlias {
+			lines[i] = parts[0] + "," + newAlias
+			count++
+		}
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), count
+}
+
+// GetFrecency scores each alias by how often and how recently it was used:
+// every connection counts, weighted down as it gets older
+func GetFrecency() map[string]float64 {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(homeDir, historyFileName))
+	if err != nil {
+		return nil // It's okay if history doesn't exist yet
+	}
+
+	now := time.Now()
+	scores := make(map[string]float64)
+	for _, line := range splitLines(data) {
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, parts[0])
+		if err != nil {
+			continue
+		}
+
+		age := now.Sub(t)
+		switch {
+		case age < 4*24*time.Hour:
+			scores[parts[1]] += 100
+		case age < 14*24*time.Hour:
+			scores[parts[1]] += 70
+		case age < 31*24*time.Hour:
+			scores[parts[1]] += 50
+		case age < 90*24*time.Hour:
+			scores[parts[1]] += 30
+		default:
+			scores[parts[1]] += 10
+		}
+	}
+	return scores
+}
+
+// GetHostHistory returns when the alias was connected to, newest first, up to limit
+func GetHostHistory(alias string, limit int) []time.Time {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(homeDir, historyFileName))
+	if err != nil {
+		return nil // It's okay if history doesn't exist yet
+	}
+
+	var times []time.Time
+	lines := splitLines(data)
+	for i := len(lines) - 1; i >= 0 && len(times) < limit; i-- {
+		parts := strings.SplitN(lines[i], ",", 2)
+		if len(parts) != 2 || parts[1] != alias {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339, parts[0]); err == nil {
+			times = append(times, t)
+		}
+	}
+	return times
+}
+
+// GetLastLayouts returns the last layout launched for each alias
+func GetLastLayouts() map[string]string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(filepath.Join(homeDir, layoutsFileName))
+	if err != nil {
+		return nil // Nothing remembered yet
+	}
+
+	// Format: prod-east-01,4g
+	layouts := make(map[string]string)
+	for _, line := range splitLines(data) {
+		parts := strings.SplitN(line, ",", 2)
+		if len(parts) == 2 {
+			layouts[parts[0]] = parts[1]
+		}
+	}
+	return layouts
+}
+
+// RememberLayout records the layout just launched for the alias
+func RememberLayout(alias, layout string) error {
+	if dryRun != nil {
+		return nil
+	}
+	unlock, err := lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	layouts := GetLastLayouts()
+	if layouts[alias] == layout {
+		return nil
+	}
+	if layouts == nil {
+		layouts = make(map[string]string)
+	}
+	layouts[alias] = layout
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(homeDir, layoutsFileName), formatLastLayouts(layouts), 0644)
+}
+
+// renameInLastLayouts moves the remembered layout of a renamed host when the
+// write is committed, under the lock like RememberLayout. It returns nil when
+// there is none.
+func renameInLastLayouts(oldAlias, newAlias string) (*fileWrite, error) {
+	if _, exists := GetLastLayouts()[oldAlias]; !exists {
+		return nil, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	build := func() ([]byte, error) {
+		layouts := GetLastLayouts()
+		layout, exists := layouts[oldAlias]
+		if !exists {
+			return nil, nil
+		}
+		delete(layouts, oldAlias)
+		layouts[newAlias] = layout
+		return formatLastLayouts(layouts), nil
+	}
+	return &fileWrite{Path: filepath.Join(homeDir, layoutsFileName), Perm: 0644, Build: build}, nil
+}
+
+func formatLastLayouts(layouts map[string]string) []byte {
+	var b strings.Builder
+	for _, alias := range sortedKeys(layouts) {
+		fmt.Fprintf(&b, "%s,%s\n", alias, layouts[alias])
+	}
+	return []byte(b.String())
+}
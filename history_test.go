@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRenameKeepsEntriesLoggedBeforeCommit checks that a rename staged before
+// the confirmation prompt doesn't drop connections logged while it is open
+func TestRenameKeepsEntriesLoggedBeforeCommit(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	historyPath := filepath.Join(home, historyFileName)
+	initial := "2026-10-01T10:00:00Z,old-db\n2026-10-01T11:00:00Z,web-01\n"
+	if err := os.WriteFile(historyPath, []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := RememberLayout("old-db", "2v"); err != nil {
+		t.Fatal(err)
+	}
+
+	history, count, err := renameInHistory("old-db", "new-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history == nil || count != 1 {
+		t.Fatalf("renameInHistory = %v, %d, want one entry", history, count)
+	}
+	layouts, err := renameInLastLayouts("old-db", "new-db")
+	if err != nil || layouts == nil {
+		t.Fatalf("renameInLastLayouts = %v, %v", layouts, err)
+	}
+
+	// Another wssh logs connections while the prompt is open
+	if err := LogConnection("old-db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RememberLayout("web-01", "4g"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := commitWrites(filepath.Join(home, "backups"), 5, "rename", *history, *layouts); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(historyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := splitLines(data)
+	if len(lines) != 3 {
+		t.Fatalf("history has %d entries, want 3:\n%s", len(lines), data)
+	}
+	for _, line := range lines {
+		if strings.HasSuffix(line, ",old-db") {
+			t.Errorf("entry not renamed: %s", line)
+		}
+	}
+	if !strings.HasSuffix(lines[2], ",new-db") {
+		t.Errorf("the entry logged before the commit was lost or not renamed: %s", lines[2])
+	}
+
+	want := map[string]string{"new-db": "2v", "web-01": "4g"}
+	got := GetLastLayouts()
+	if len(got) != len(want) || got["new-db"] != "2v" || got["web-01"] != "4g" {
+		t.Errorf("layouts = %v, want %v", got, want)
+	}
+}
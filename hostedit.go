@@ -0,0 +1,692 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 'wssh host' and 'wssh group' change the inventory in place. Edits go to the
+// file that defines the host or group (includes too), and the managed block of
+// ~/.ssh/config is regenerated in the same write.
+
+// inventoryEdit stages changes to the files of a merged config
+type inventoryEdit struct {
+	cfg   *Config
+	files []*ConfigFile // In merge order, the main file first
+	dirty map[*ConfigFile]bool
+	extra []fileWrite // Other files written with the change, e.g. the history
+}
+
+func newInventoryEdit(cfg *Config) (*inventoryEdit, error) {
+	paths := cfg.files
+	if len(paths) == 0 {
+		paths = []string{cfg.path}
+	}
+	e := &inventoryEdit{cfg: cfg, dirty: make(map[*ConfigFile]bool)}
+	for _, path := range paths {
+		f, err := OpenConfigFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		e.files = append(e.files, f)
+	}
+	return e, nil
+}
+
+// file returns the opened file for path, the main file if it wasn't merged in
+func (e *inventoryEdit) file(path string) *ConfigFile {
+	for _, f := range e.files {
+		if f.Path == path {
+			return f
+		}
+	}
+	return e.files[0]
+}
+
+// hostFile is the file whose definition of the host is in effect
+func (e *inventoryEdit) hostFile(alias string) *ConfigFile {
+	return e.file(e.cfg.origins["hosts."+alias])
+}
+
+// groupFiles are the files defining the group, in merge order
+func (e *inventoryEdit) groupFiles(name string) []*ConfigFile {
+	var files []*ConfigFile
+	for _, f := range e.files {
+		if f.findGroup(name) != nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// commit shows the diff of every changed file, ~/.ssh/config included, and
+// writes them together after confirmation
+func (e *inventoryEdit) commit(reason string, yes bool) error {
+	data := make(map[string][]byte)
+	var writes []fileWrite
+	var diff string
+	for _, f := range e.files {
+		if !e.dirty[f] {
+			continue
+		}
+		b, err := f.Bytes()
+		if err != nil {
+			return err
+		}
+		data[f.Path] = b
+		writes = append(writes, fileWrite{Path: f.Path, Data: b, Perm: 0644})
+		diff += unifiedDiff(shortPath(f.Path), shortPath(f.Path)+" (edited)", f.raw, b)
+	}
+	if len(writes) == 0 {
+		fmt.Println("Nothing to change.")
+		return nil
+	}
+
+	updated, err := e.cfg.reloadWith(data)
+	if err != nil {
+		return err
+	}
+	sync, err := planSSHConfigSync(updated)
+	if err != nil {
+		return err
+	}
+	writes = append(writes, sync.writes...)
+	writes = append(writes, e.extra...)
+
+	fmt.Print(diff + sync.diff)
+	for _, w := range sync.warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+	if !yes && dryRun == nil && !askYesNo("\nWrite these changes?") {
+		fmt.Println("Nothing was written.")
+		return nil
+	}
+
+	backupDir, keep := backupSettings(e.cfg.Settings)
+	if err := commitWrites(backupDir, keep, reason, writes...); err != nil {
+		return err
+	}
+	if dryRun == nil {
+		var paths []string
+		for _, w := range writes {
+			paths = append(paths, shortPath(w.Path))
+		}
+		fmt.Printf("✅ Updated %s\n", strings.Join(paths, ", "))
+	}
+	return nil
+}
+
+// --- Field edits ---
+
+// fieldChanges are the edits made to one host or group
+type fieldChanges struct {
+	set        map[string]string // YAML key to new value, e.g. "hostname" or "port"
+	unset      []string
+	tags       []string // Replace the tags when setTags is true
+	setTags    bool
+	addTags    []string
+	removeTags []string
+	options    map[string]string // ssh_options to set, an empty value removes the option
+}
+
+func (c fieldChanges) empty() bool {
+	return len(c.set) == 0 && len(c.unset) == 0 && !c.setTags && len(c.addTags) == 0 && len(c.removeTags) == 0 && len(c.options) == 0
+}
+
+// editableFields are the keys each kind of entry accepts
+var editableFields = map[string][]string{
+	"host":  {"hostname", "tags", "notes", "user", "port", "identity_file", "jump", "agent_env"},
+	"group": {"tags", "profile", "log_session", "user", "port", "identity_file", "jump", "agent_env"},
+}
+
+// validate checks the new values against the kind of entry and the config
+func (c fieldChanges) validate(kind string, cfg *Config) error {
+	for _, key := range append(fieldOrder(c.set), c.unset...) {
+		if !containsString(editableFields[kind], key) && key != "ssh_options" {
+			return fmt.Errorf("a %s has no field '%s' (fields: %s, ssh_options)", kind, key, strings.Join(editableFields[kind], ", "))
+		}
+	}
+	if containsString(c.unset, "hostname") {
+		return fmt.Errorf("hostname cannot be removed")
+	}
+	if v, ok := c.set["hostname"]; ok && v == "" {
+		return fmt.Errorf("hostname cannot be empty")
+	}
+	if v, ok := c.set["port"]; ok {
+		if port, err := strconv.Atoi(v); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port '%s'", v)
+		}
+	}
+	if v, ok := c.set["log_session"]; ok {
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("invalid log_session '%s' (expected true or false)", v)
+		}
+	}
+	if v, ok := c.set["agent_env"]; ok {
+		if _, exists := cfg.Settings.SSHAgentEnvs[v]; !exists {
+			return fmt.Errorf("unknown agent_env '%s'", v)
+		}
+	}
+	return nil
+}
+
+// apply edits a host or group mapping. Other files defining the same group
+// (primary false) only get the keys they already set updated or removed, so the
+// merged result is what was asked for.
+func (c fieldChanges) apply(n *yaml.Node, primary bool) {
+	for _, key := range fieldOrder(c.set) {
+		if !primary && mappingValue(n, key) == nil {
+			continue
+		}
+		tag := "!!str"
+		switch key {
+		case "port":
+			tag = "!!int"
+		case "log_session":
+			tag = "!!bool"
+		}
+		setScalar(n, key, c.set[key], tag)
+	}
+	for _, key := range c.unset {
+		deleteMappingKey(n, key)
+	}
+
+	tags := stringList(mappingValue(n, "tags"))
+	switch {
+	case c.setTags && primary:
+		tags = append([]string{}, c.tags...)
+	case c.setTags:
+		tags = nil
+	}
+	if primary {
+		tags = appendMissing(tags, c.addTags...)
+	}
+	var kept []string
+	for _, t := range tags {
+		if !containsString(c.removeTags, t) {
+			kept = append(kept, t)
+		}
+	}
+	if c.setTags || len(c.addTags) > 0 || len(c.removeTags) > 0 {
+		setStringList(n, "tags", kept)
+	}
+
+	if len(c.options) > 0 {
+		options := mappingValue(n, "ssh_options")
+		for _, key := range sortedKeys(c.options) {
+			value := c.options[key]
+			switch {
+			case value == "":
+				deleteMappingKey(options, key)
+			case options != nil && options.Kind == yaml.MappingNode:
+				setScalar(options, key, value, "!!str")
+			case primary:
+				options = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+				insertMappingValue(n, "ssh_options", options)
+				setScalar(options, key, value, "!!str")
+			}
+		}
+		if options != nil && len(options.Content) == 0 {
+			deleteMappingKey(n, "ssh_options")
+		}
+	}
+}
+
+// stringList reads a sequence of strings
+func stringList(n *yaml.Node) []string {
+	var list []string
+	if n != nil && n.Kind == yaml.SequenceNode {
+		for _, item := range n.Content {
+			list = append(list, item.Value)
+		}
+	}
+	return list
+}
+
+// setStringList replaces a list of strings, keeping the existing list's style.
+// An empty list removes the key.
+func setStringList(n *yaml.Node, key string, list []string) {
+	if len(list) == 0 {
+		deleteMappingKey(n, key)
+		return
+	}
+	seq := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+	var quoting yaml.Style
+	if old := mappingValue(n, key); old != nil && old.Kind == yaml.SequenceNode {
+		seq.Style = old.Style & yaml.FlowStyle
+		if item := sequenceItem(old, 0); item != nil {
+			quoting = item.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+		}
+	}
+	for _, item := range list {
+		seq.Content = append(seq.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item, Style: quoting})
+	}
+	insertMappingValue(n, key, seq)
+}
+
+// fieldOrder lists the keys being set in the order the config writes them, so new
+// keys are added in the usual place
+func fieldOrder(set map[string]string) []string {
+	order := append(append([]string{}, editableFields["group"]...), "hostname", "notes")
+	var keys []string
+	for _, key := range sortedKeys(set) {
+		if !containsString(order, key) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range order {
+		if _, ok := set[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// editFlags holds the values of the 'host edit' and 'group edit' flags
+type editFlags struct {
+	Hostname, Notes, User, Port, IdentityFile, Jump, AgentEnv, Profile string
+	LogSession                                                         bool
+	Tags, AddTags, RemoveTags, Options, Unset                          []string
+}
+
+// editFlagFields maps the value flags to the keys they set
+var editFlagFields = map[string]string{
+	"hostname":      "hostname",
+	"notes":         "notes",
+	"user":          "user",
+	"port":          "port",
+	"identity-file": "identity_file",
+	"jump":          "jump",
+	"agent-env":     "agent_env",
+	"profile":       "profile",
+}
+
+// changes turns the flags that were given (changed reports which) into edits
+func (ef *editFlags) changes(changed func(name string) bool) (fieldChanges, error) {
+	c := fieldChanges{set: make(map[string]string), options: make(map[string]string)}
+	values := map[string]string{
+		"hostname": ef.Hostname, "notes": ef.Notes, "user": ef.User, "port": ef.Port, "identity-file": ef.IdentityFile,
+		"jump": ef.Jump, "agent-env": ef.AgentEnv, "profile": ef.Profile,
+	}
+	for flag, key := range editFlagFields {
+		if !changed(flag) {
+			continue
+		}
+		if values[flag] == "" {
+			c.unset = append(c.unset, key)
+		} else {
+			c.set[key] = values[flag]
+		}
+	}
+	if changed("log-session") {
+		c.set["log_session"] = strconv.FormatBool(ef.LogSession)
+	}
+	if changed("tags") {
+		c.setTags = true
+		c.tags = splitTags(strings.Join(ef.Tags, ","))
+	}
+	c.addTags = splitTags(strings.Join(ef.AddTags, ","))
+	c.removeTags = splitTags(strings.Join(ef.RemoveTags, ","))
+	for _, o := range ef.Options {
+		key, value, ok := strings.Cut(o, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return c, fmt.Errorf("invalid --option '%s' (expected Key=Value, or Key= to remove it)", o)
+		}
+		c.options[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	for _, key := range ef.Unset {
+		key = strings.ReplaceAll(key, "-", "_")
+		if key == "tags" {
+			c.setTags, c.tags = true, nil
+			continue
+		}
+		c.unset = append(c.unset, key)
+	}
+	return c, nil
+}
+
+// splitTags splits a comma separated list, dropping empty entries
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// askChanges prompts for each editable field, showing the current value.
+// Enter keeps a value, "-" removes it.
+func askChanges(kind string, n *yaml.Node) fieldChanges {
+	c := fieldChanges{set: make(map[string]string)}
+	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Println("Enter keeps the current value, - removes it.")
+	for _, key := range editableFields[kind] {
+		current := mappingValue(n, key)
+		shown := ""
+		if current != nil {
+			if current.Kind == yaml.SequenceNode {
+				shown = strings.Join(stringList(current), ", ")
+			} else {
+				shown = current.Value
+			}
+		}
+
+		fmt.Printf("%s [%s]: ", key, shown)
+		scanner.Scan()
+		input := strings.TrimSpace(scanner.Text())
+		switch {
+		case input == "":
+		case input == "-" && key == "tags":
+			c.setTags = true
+		case input == "-":
+			c.unset = append(c.unset, key)
+		case key == "tags":
+			c.setTags, c.tags = true, splitTags(input)
+		default:
+			c.set[key] = input
+		}
+	}
+	return c
+}
+
+// --- Host commands ---
+
+// checkHosts fails unless every alias is in the inventory
+func checkHosts(cfg *Config, aliases ...string) error {
+	for _, alias := range aliases {
+		if _, exists := cfg.origins["hosts."+alias]; !exists {
+			return fmt.Errorf("no host '%s' in the inventory", alias)
+		}
+	}
+	return nil
+}
+
+// checkNewName rejects empty names and names with spaces or commas, which
+// can't be used in ssh_config or jump lists
+func checkNewName(kind, name string) error {
+	if name == "" || strings.ContainsAny(name, " \t,#") {
+		return fmt.Errorf("invalid %s name '%s'", kind, name)
+	}
+	return nil
+}
+
+// RunHostEdit changes the fields of a host, prompting for them when no change is given
+func RunHostEdit(cfg *Config, alias string, changes fieldChanges, yes bool) error {
+	if err := checkHosts(cfg, alias); err != nil {
+		return err
+	}
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	f := e.hostFile(alias)
+	host, _ := f.findHost(alias)
+
+	if changes.empty() {
+		if !isInteractive() {
+			return fmt.Errorf("nothing to change, see 'wssh host edit --help'")
+		}
+		fmt.Printf("--- Edit %s (%s) ---\n", alias, shortPath(f.Path))
+		changes = askChanges("host", host)
+		if changes.empty() {
+			fmt.Println("Nothing to change.")
+			return nil
+		}
+	}
+	if err := changes.validate("host", cfg); err != nil {
+		return err
+	}
+
+	changes.apply(host, true)
+	e.dirty[f] = true
+	return e.commit(fmt.Sprintf("edit host %s", alias), yes)
+}
+
+// RunHostRemove deletes hosts from every file that defines them
+func RunHostRemove(cfg *Config, aliases []string, yes bool) error {
+	if err := checkHosts(cfg, aliases...); err != nil {
+		return err
+	}
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		for _, f := range e.files {
+			if f.RemoveHost(alias) != nil {
+				e.dirty[f] = true
+			}
+		}
+	}
+
+	warnJumpsThrough(cfg, aliases)
+	return e.commit(fmt.Sprintf("remove host %s", strings.Join(aliases, ", ")), yes)
+}
+
+// warnJumpsThrough points out the hosts that would stop working when the given
+// hosts are removed, because they jump through them
+func warnJumpsThrough(cfg *Config, removed []string) {
+	for _, h := range buildSearchableHosts(cfg) {
+		for _, hop := range strings.Split(h.SSH.Jump, ",") {
+			if hop = strings.TrimSpace(hop); containsString(removed, hop) && !containsString(removed, h.Alias) {
+				fmt.Printf("warning: %s jumps through %s\n", h.Alias, hop)
+			}
+		}
+	}
+}
+
+// RunHostMove moves hosts to another group, creating it if needed. Each host
+// stays in the file that defines it.
+func RunHostMove(cfg *Config, aliases []string, groupName string, yes bool) error {
+	if err := checkHosts(cfg, aliases...); err != nil {
+		return err
+	}
+	if err := checkNewName("group", groupName); err != nil {
+		return err
+	}
+	if i := cfg.groupIndex(groupName); i >= 0 {
+		groupName = cfg.Groups[i].Name
+	}
+
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, alias := range aliases {
+		if strings.EqualFold(cfg.LookupHost(alias).GroupName, groupName) {
+			fmt.Printf("%s is already in %s\n", alias, groupName)
+			continue
+		}
+		f := e.hostFile(alias)
+		if err := f.InsertHost(groupName, f.RemoveHost(alias)); err != nil {
+			return err
+		}
+		e.dirty[f] = true
+	}
+	return e.commit(fmt.Sprintf("move %s to group %s", strings.Join(aliases, ", "), groupName), yes)
+}
+
+// RunHostRename changes an alias everywhere: its definition, jump settings,
+// layout panes, ~/.ssh/config and the connection history
+func RunHostRename(cfg *Config, oldAlias, newAlias string, yes bool) error {
+	if err := checkHosts(cfg, oldAlias); err != nil {
+		return err
+	}
+	if err := checkNewName("host", newAlias); err != nil {
+		return err
+	}
+	if _, exists := cfg.origins["hosts."+newAlias]; exists {
+		return fmt.Errorf("host '%s' already exists", newAlias)
+	}
+
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range e.files {
+		if f.RenameHost(oldAlias, newAlias) {
+			e.dirty[f] = true
+		}
+	}
+
+	history, count, err := renameInHistory(oldAlias, newAlias)
+	if err != nil {
+		return fmt.Errorf("failed to read the history: %v", err)
+	}
+	if history != nil {
+		fmt.Printf("History entries to rename: %d\n", count)
+		e.extra = append(e.extra, *history)
+	}
+	layouts, err := renameInLastLayouts(oldAlias, newAlias)
+	if err != nil {
+		return fmt.Errorf("failed to read the remembered layouts: %v", err)
+	}
+	if layouts != nil {
+		e.extra = append(e.extra, *layouts)
+	}
+	return e.commit(fmt.Sprintf("rename host %s to %s", oldAlias, newAlias), yes)
+}
+
+// --- Group commands ---
+
+// checkGroup fails unless the group is in the inventory
+func checkGroup(cfg *Config, name string) error {
+	if cfg.groupIndex(name) < 0 {
+		return fmt.Errorf("no group '%s' in the inventory", name)
+	}
+	return nil
+}
+
+// RunGroupEdit changes the settings of a group, prompting for them when no change is given
+func RunGroupEdit(cfg *Config, name string, changes fieldChanges, yes bool) error {
+	if err := checkGroup(cfg, name); err != nil {
+		return err
+	}
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	files := e.groupFiles(name)
+
+	if changes.empty() {
+		if !isInteractive() {
+			return fmt.Errorf("nothing to change, see 'wssh group edit --help'")
+		}
+		fmt.Printf("--- Edit group %s (%s) ---\n", name, shortPath(files[0].Path))
+		changes = askChanges("group", files[0].findGroup(name))
+		if changes.empty() {
+			fmt.Println("Nothing to change.")
+			return nil
+		}
+	}
+	if err := changes.validate("group", cfg); err != nil {
+		return err
+	}
+
+	for i, f := range files {
+		changes.apply(f.findGroup(name), i == 0)
+		e.dirty[f] = true
+	}
+	return e.commit(fmt.Sprintf("edit group %s", name), yes)
+}
+
+// RunGroupRemove deletes a group and its hosts from every file that defines it
+func RunGroupRemove(cfg *Config, name string, yes bool) error {
+	if err := checkGroup(cfg, name); err != nil {
+		return err
+	}
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range e.groupFiles(name) {
+		f.RemoveGroup(name)
+		e.dirty[f] = true
+	}
+	var aliases []string
+	for _, h := range cfg.Groups[cfg.groupIndex(name)].Hosts {
+		aliases = append(aliases, h.Alias)
+	}
+	if len(aliases) > 0 {
+		fmt.Printf("This removes %d host(s) with the group: %s\n", len(aliases), strings.Join(aliases, ", "))
+	}
+	warnJumpsThrough(cfg, aliases)
+	return e.commit(fmt.Sprintf("remove group %s", name), yes)
+}
+
+// RunGroupMove moves every host of a group into another one and removes the
+// emptied group. The hosts lose the settings of the group they leave.
+func RunGroupMove(cfg *Config, from, to string, yes bool) error {
+	if err := checkGroup(cfg, from); err != nil {
+		return err
+	}
+	if err := checkNewName("group", to); err != nil {
+		return err
+	}
+	if strings.EqualFold(from, to) {
+		return fmt.Errorf("cannot move a group into itself")
+	}
+	if i := cfg.groupIndex(to); i >= 0 {
+		to = cfg.Groups[i].Name
+	}
+
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range e.groupFiles(from) {
+		hosts := mappingValue(f.findGroup(from), "hosts")
+		if hosts != nil && hosts.Kind == yaml.SequenceNode {
+			for _, h := range hosts.Content {
+				if err := f.InsertHost(to, h); err != nil {
+					return err
+				}
+			}
+		}
+		f.RemoveGroup(from)
+		e.dirty[f] = true
+	}
+	return e.commit(fmt.Sprintf("move the hosts of group %s to %s", from, to), yes)
+}
+
+// RunGroupRename renames a group in every file that defines it, along with the
+// agent env rules that refer to it
+func RunGroupRename(cfg *Config, oldName, newName string, yes bool) error {
+	if err := checkGroup(cfg, oldName); err != nil {
+		return err
+	}
+	if err := checkNewName("group", newName); err != nil {
+		return err
+	}
+	if cfg.groupIndex(newName) >= 0 && !strings.EqualFold(oldName, newName) {
+		return fmt.Errorf("group '%s' already exists (use 'wssh group mv' to merge them)", newName)
+	}
+
+	e, err := newInventoryEdit(cfg)
+	if err != nil {
+		return err
+	}
+	for _, f := range e.files {
+		if f.RenameGroup(oldName, newName) {
+			e.dirty[f] = true
+		}
+	}
+	return e.commit(fmt.Sprintf("rename group %s to %s", oldName, newName), yes)
+}
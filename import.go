@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RunImportSSHConfig merges the concrete hosts of an ssh_config file into the
+// inventory. Hosts whose alias is already in the inventory are skipped, the rest
+// are grouped by "# group:" markers or naming patterns (or all into group, when
+// set), and the resulting change is shown as a diff before it is written.
+func RunImportSSHConfig(cfg *Config, path, group string, yes bool) error {
+	sshHosts, warnings, err := ParseSSHConfig(path)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+
+	existing := make(map[string]bool)
+	for _, h := range buildSearchableHosts(cfg) {
+		existing[h.Alias] = true
+	}
+
+	var toImport []SSHConfigHost
+	var skipped []string
+	for _, h := range sshHosts {
+		if existing[h.Alias] {
+			skipped = append(skipped, h.Alias)
+			continue
+		}
+		if group != "" {
+			h.Group = group
+		}
+		toImport = append(toImport, h)
+	}
+
+	if len(skipped) > 0 {
+		fmt.Printf("Already in the inventory, skipped: %s\n", strings.Join(skipped, ", "))
+	}
+	if len(toImport) == 0 {
+		fmt.Printf("Nothing to import from %s.\n", shortPath(path))
+		return nil
+	}
+
+	// Stage the edits on the config file
+	file, err := OpenConfigFile(cfg.path)
+	if err != nil {
+		return err
+	}
+	groups := groupsFromSSHConfig(toImport)
+	fmt.Println("\nProposed groups:")
+	for _, g := range groups {
+		state := "new"
+		if cfg.groupIndex(g.Name) >= 0 {
+			state = "existing"
+		}
+		var aliases []string
+		for _, h := range g.Hosts {
+			aliases = append(aliases, h.Alias)
+			if err := file.AddHost(g.Name, h); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("  - %-15s (%s) %s\n", g.Name, state, strings.Join(aliases, ", "))
+	}
+
+	after, err := file.Bytes()
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	fmt.Print(unifiedDiff(shortPath(cfg.path), shortPath(cfg.path)+" (after import)", file.raw, after))
+
+	if !yes && dryRun == nil && !askYesNo(fmt.Sprintf("\nImport %d host(s) into %s?", len(toImport), shortPath(cfg.path))) {
+		fmt.Println("Nothing was written.")
+		return nil
+	}
+
+	if err := file.Save(fmt.Sprintf("import %d hosts from %s", len(toImport), shortPath(path))); err != nil {
+		return err
+	}
+	if dryRun == nil {
+		fmt.Printf("✅ Imported %d host(s) into %s\n", len(toImport), shortPath(cfg.path))
+	}
+	return nil
+}
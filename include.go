@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A config can be split across files: the main file, then the files matched by
+// its include globs in the order listed, then <config>.d/*.yaml (~/.wssh.d for
+// ~/.wssh.yaml), each sorted by name. Later files are merged into earlier ones:
+//   - groups with the same name (case-insensitive) are combined, hosts appended
+//   - macros, payloads, layouts and ssh_agent_envs are merged key by key
+//   - any other setting, and any group setting, is replaced when a later file sets it
+//   - a host alias defined again in a later file replaces the earlier host
+
+// includeDir is the drop-in directory next to the main config
+func includeDir(configPath string) string {
+	return strings.TrimSuffix(configPath, filepath.Ext(configPath)) + ".d"
+}
+
+// includedFiles resolves the include globs (relative to the main config) and the
+// drop-in directory into the list of extra files to load, without duplicates
+func includedFiles(configPath string, include []string) ([]string, error) {
+	seen := map[string]bool{configPath: true}
+	var files []string
+	add := func(pattern string) error {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("bad include pattern '%s': %v", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if info, err := os.Stat(m); err != nil || info.IsDir() || seen[m] {
+				continue
+			}
+			seen[m] = true
+			files = append(files, m)
+		}
+		return nil
+	}
+
+	for _, pattern := range include {
+		pattern = expandPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(configPath), pattern)
+		}
+		if err := add(pattern); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := includeDir(configPath)
+	for _, ext := range []string{"*.yaml", "*.yml"} {
+		if err := add(filepath.Join(dir, ext)); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// readConfigFile parses a single config file without following its includes
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse yaml: %w", err)
+	}
+	return &cfg, nil
+}
+
+// reloadWith merges the files of cfg again, taking the contents of the files in
+// data from there instead of disk. It shows the result of edits before they are written.
+func (cfg *Config) reloadWith(data map[string][]byte) (*Config, error) {
+	files := cfg.files
+	if len(files) == 0 {
+		files = []string{cfg.path}
+	}
+
+	merged := &Config{path: cfg.path, Include: cfg.Include}
+	for _, file := range files {
+		var part *Config
+		if contents, ok := data[file]; ok {
+			part = &Config{}
+			if err := yaml.Unmarshal(contents, part); err != nil {
+				return nil, fmt.Errorf("%s: failed to parse yaml: %w", file, err)
+			}
+		} else {
+			var err error
+			if part, err = readConfigFile(file); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		merged.merge(part, file)
+	}
+	return merged, nil
+}
+
+// merge folds the config read from file into cfg, recording where values came from
+func (cfg *Config) merge(src *Config, file string) {
+	if cfg.origins == nil {
+		cfg.origins = make(map[string]string)
+	}
+	cfg.files = append(cfg.files, file)
+
+	mergeSettings(&cfg.Settings, src.Settings, file, cfg.origins)
+	mergeByKey(&cfg.Macros, src.Macros, "macros", file, cfg.origins)
+	mergeByKey(&cfg.Payloads, src.Payloads, "payloads", file, cfg.origins)
+	mergeByKey(&cfg.Layouts, src.Layouts, "layouts", file, cfg.origins)
+
+	for _, g := range src.Groups {
+		// A host redefined in a later file replaces the earlier one
+		for _, h := range g.Hosts {
+			if prev, exists := cfg.origins["hosts."+h.Alias]; exists && prev != file {
+				cfg.warnings = append(cfg.warnings, fmt.Sprintf("host '%s' in %s replaces the one defined in %s", h.Alias, shortPath(file), shortPath(prev)))
+				cfg.removeHost(h.Alias)
+			}
+			cfg.origins["hosts."+h.Alias] = file
+		}
+
+		i := cfg.groupIndex(g.Name)
+		if i < 0 {
+			cfg.Groups = append(cfg.Groups, g)
+			cfg.origins["groups."+strings.ToLower(g.Name)] = file
+			continue
+		}
+
+		dst := &cfg.Groups[i]
+		dst.Hosts = append(dst.Hosts, g.Hosts...)
+		dst.Tags = appendMissing(dst.Tags, g.Tags...)
+		if g.Profile != "" {
+			dst.Profile = g.Profile
+		}
+		if g.LogSession {
+			dst.LogSession = true
+		}
+		dst.SSHSettings = mergeSSHSettings(dst.SSHSettings, g.SSHSettings)
+		if key := "groups." + strings.ToLower(g.Name); !containsString(strings.Split(cfg.origins[key], ", "), file) {
+			cfg.origins[key] += ", " + file
+		}
+	}
+}
+
+// mergeSettings copies every setting the later file sets. Maps (ssh_agent_envs)
+// are merged key by key.
+func mergeSettings(dst *Settings, src Settings, file string, origins map[string]string) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src)
+	for i := 0; i < sv.NumField(); i++ {
+		field := sv.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		key := "settings." + strings.Split(sv.Type().Field(i).Tag.Get("yaml"), ",")[0]
+
+		if field.Kind() == reflect.Map {
+			if dv.Field(i).IsNil() {
+				dv.Field(i).Set(reflect.MakeMap(field.Type()))
+			}
+			iter := field.MapRange()
+			for iter.Next() {
+				dv.Field(i).SetMapIndex(iter.Key(), iter.Value())
+				origins[key+"."+iter.Key().String()] = file
+			}
+			continue
+		}
+		dv.Field(i).Set(field)
+		origins[key] = file
+	}
+}
+
+// mergeByKey adds the entries of src to dst, replacing entries with the same key
+func mergeByKey[V any](dst *map[string]V, src map[string]V, section, file string, origins map[string]string) {
+	if len(src) == 0 {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]V)
+	}
+	for k, v := range src {
+		(*dst)[k] = v
+		origins[section+"."+k] = file
+	}
+}
+
+// groupIndex finds a group by name (case-insensitive), or -1
+func (cfg *Config) groupIndex(name string) int {
+	for i, g := range cfg.Groups {
+		if strings.EqualFold(g.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeHost drops every host with the alias from the merged groups
+func (cfg *Config) removeHost(alias string) {
+	for i := range cfg.Groups {
+		hosts := cfg.Groups[i].Hosts[:0]
+		for _, h := range cfg.Groups[i].Hosts {
+			if h.Alias != alias {
+				hosts = append(hosts, h)
+			}
+		}
+		cfg.Groups[i].Hosts = hosts
+	}
+}
+
+func appendMissing(list []string, items ...string) []string {
+	for _, item := range items {
+		if !containsString(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// shortPath writes paths under the home directory with ~
+func shortPath(path string) string {
+	homeDir, err := os.UserHomeDir()
+	if err == nil && strings.HasPrefix(path, homeDir+string(filepath.Separator)) {
+		return "~" + path[len(homeDir):]
+	}
+	return path
+}
+
+// PrintMergedConfig prints the effective config, each value commented with the file it came from
+func PrintMergedConfig(cfg *Config) error {
+	merged := *cfg
+	merged.Include = nil
+
+	var doc yaml.Node
+	if err := doc.Encode(&merged); err != nil {
+		return err
+	}
+
+	origin := func(key string) string {
+		if file, ok := cfg.origins[key]; ok {
+			return "# " + shortPath(file)
+		}
+		return ""
+	}
+	annotateKeys := func(n *yaml.Node, prefix string) {
+		if n == nil || n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			n.Content[i].LineComment = origin(prefix + n.Content[i].Value)
+		}
+	}
+
+	settings := mappingValue(&doc, "settings")
+	annotateKeys(settings, "settings.")
+	annotateKeys(mappingValue(settings, "ssh_agent_envs"), "settings.ssh_agent_envs.")
+	annotateKeys(mappingValue(&doc, "macros"), "macros.")
+	annotateKeys(mappingValue(&doc, "payloads"), "payloads.")
+	annotateKeys(mappingValue(&doc, "layouts"), "layouts.")
+
+	if groups := mappingValue(&doc, "groups"); groups != nil {
+		for _, g := range groups.Content {
+			if name := mappingValue(g, "name"); name != nil {
+				files := strings.Split(cfg.origins["groups."+strings.ToLower(name.Value)], ", ")
+				for i, f := range files {
+					files[i] = shortPath(f)
+				}
+				name.LineComment = "# " + strings.Join(files, ", ")
+			}
+			if hosts := mappingValue(g, "hosts"); hosts != nil {
+				for _, h := range hosts.Content {
+					if alias := mappingValue(h, "alias"); alias != nil {
+						alias.LineComment = origin("hosts." + alias.Value)
+					}
+				}
+			}
+		}
+	}
+
+	fmt.Println("# Effective configuration, merged from:")
+	for _, f := range cfg.files {
+		fmt.Printf("#   %s\n", shortPath(f))
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	fmt.Print(buf.String())
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigHeader documents every section except the groups, which are
+// either the examples below or seeded from ~/.ssh/config by `wssh init`.
+const defaultConfigHeader = `# wssh configuration
+# Run 'wssh init' to regenerate this file, optionally seeded from ~/.ssh/config.
+
+# Extra files merged into this one, e.g. a shared team inventory. Files in
+# ~/.wssh.d/*.yaml are always merged in after these.
+# include:
+#   - "~/work/inventory/*.yaml"
+
+settings:
+  # Terminal to open sessions in: auto (default), iterm or tmux
+  terminal: auto
+
+  # Skip host key checks (default true). Set to false to keep StrictHostKeyChecking.
+  ignore_key_changes: true
+
+  # Open single sessions in a new tab (tab) or in the current terminal (inline)
+  connect_mode: tab
+
+  # Default layout for 'wssh connect' and ctrl+a in the TUI ('auto' packs hosts into a grid)
+  # tile_layout: auto
+  # tile_max_panes: 9
+
+  # Every change wssh makes to this file and ~/.ssh/config is backed up first.
+  # List and roll back with 'wssh config restore'.
+  # backup_dir: "~/.wssh_backups"
+  # backup_keep: 20
+
+  # Where 'wssh sync-ssh-config' and 'wssh add' write the inventory hosts: a
+  # "# BEGIN wssh" block in ~/.ssh/config (block) or ~/.ssh/wssh_config (include)
+  # ssh_config_mode: block
+
+  # ssh-agent environments primed by 'wssh auth'. Hosts pick one by agent_env,
+  # by the match/groups/tags rules, or by alias prefix (see the README).
+  # agent_expiration_hours: 23.5
+  # auth_check_env: default
+  # ssh_agent_envs:
+  #   default:
+  #     sock: "~/.ssh/agent-default.sock"
+  #     key: "~/.ssh/id_ed25519"
+  #   prod:
+  #     sock: "~/.ssh/agent-prod.sock"
+  #     key: "~/.ssh/prod-cert"
+  #     groups: ["production"]
+
+# Commands injected into the active pane with 'wssh macro <name>'
+macros:
+  check_logs: "tail -f /var/log/syslog"
+  disk: "df -h"
+
+# Archives pushed and extracted with 'wssh pushinstall <payload> <host>'
+payloads:
+  # dotfiles: "~/payloads/dotfiles.tgz"
+
+# Custom layouts: rows stacked top to bottom, panes placed left to right.
+# Built-in layouts: single, 2h, 2v, 3h, 3v, 4g
+layouts:
+  debug:
+    description: "Shell on top, htop and the journal below"
+    rows:
+      - panes: 1
+        size: 2
+      - panes: 2
+        commands:
+          - command: "htop"
+          - command: "journalctl -f"
+`
+
+// defaultConfigGroups are placeholder hosts so the TUI has something to show
+const defaultConfigGroups = `
+# Hosts, organised in groups. Group settings (user, port, identity_file, jump,
+# ssh_options, agent_env, profile, log_session) apply to every host in the group.
+groups:
+  - name: "example"
+    tags: ["sample"]
+    hosts:
+      - alias: "example-web-01"
+        hostname: "web01.example.com"
+        tags: ["web"]
+      - alias: "example-db-01"
+        hostname: "db01.example.com"
+        tags: ["db"]
+        user: "admin"
+        notes: "Free text, shown in the TUI detail pane (ctrl+o)"
+`
+
+// generateDefaultConfig writes the documented starter config
+func generateDefaultConfig(path string) error {
+	return writeConfigFile(path, defaultConfigHeader+defaultConfigGroups)
+}
+
+// writeConfigFile creates the config (and its directory) with the given content.
+// An existing config is backed up first, to wherever it keeps its backups.
+func writeConfigFile(path, content string) error {
+	var settings Settings
+	if existing, err := OpenConfigFile(path); err == nil {
+		settings = existing.settings()
+	}
+	backupDir, keep := backupSettings(settings)
+	return commitWrites(backupDir, keep, "starter configuration", fileWrite{Path: path, Data: []byte(content), Perm: 0644})
+}
+
+// RunInit interactively writes a starter config, optionally seeding the
+// groups from the hosts already defined in ~/.ssh/config
+func RunInit(configPath string) error {
+	scanner := bufio.NewScanner(os.Stdin)
+
+	// Helper to prompt and capture input
+	ask := func(prompt string) string {
+		fmt.Print(prompt)
+		scanner.Scan()
+		return strings.ToLower(strings.TrimSpace(scanner.Text()))
+	}
+
+	fmt.Println("--- wssh init ---")
+
+	if _, err := os.Stat(configPath); err == nil {
+		if answer := ask(fmt.Sprintf("%s already exists. Overwrite it? (y/N): ", configPath)); answer != "y" && answer != "yes" {
+			fmt.Println("Keeping the existing configuration.")
+			return nil
+		}
+	}
+
+	groupsYAML := defaultConfigGroups
+
+	// Offer to seed the groups from ~/.ssh/config
+	homeDir, _ := os.UserHomeDir()
+	sshConfigPath := filepath.Join(homeDir, ".ssh", "config")
+	if sshHosts, _, err := ParseSSHConfig(sshConfigPath); err == nil && len(sshHosts) > 0 {
+		answer := ask(fmt.Sprintf("Found %d hosts in %s. Import them as groups? (Y/n): ", len(sshHosts), sshConfigPath))
+		if answer == "" || answer == "y" || answer == "yes" {
+			groups := groupsFromSSHConfig(sshHosts)
+
+			var buf bytes.Buffer
+			enc := yaml.NewEncoder(&buf)
+			enc.SetIndent(2)
+			if err := enc.Encode(map[string][]Group{"groups": groups}); err != nil {
+				return fmt.Errorf("failed to marshal YAML: %v", err)
+			}
+			groupsYAML = "\n# Imported from " + sshConfigPath + "\n" + buf.String()
+
+			fmt.Println("\nProposed groups:")
+			for _, g := range groups {
+				fmt.Printf("  - %-15s %d host(s)\n", g.Name, len(g.Hosts))
+			}
+		}
+	}
+
+	if err := writeConfigFile(configPath, defaultConfigHeader+groupsYAML); err != nil {
+		return fmt.Errorf("failed to write %s: %v", configPath, err)
+	}
+	fmt.Printf("\n✅ Wrote %s\n", configPath)
+	return nil
+}
+
+// isInteractive reports whether stdin is a terminal we can prompt on. A mode
+// check isn't enough: /dev/null (cron, CI) is a character device too.
+func isInteractive() bool {
+	return term.IsTerminal(os.Stdin.Fd())
+}
@@ -2,14 +2,16 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"strings"
-	"time"
 )
 
 func ExecuteAppleScript(script string) error {
+	if dryRun != nil {
+		dryRun.record(PlanStep{Kind: "applescript", Script: script})
+		return nil
+	}
+
 	cmd := exec.Command("osascript", "-e", script)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -18,147 +20,90 @@ func ExecuteAppleScript(script string) error {
 	return nil
 }
 
-// LaunchLayout handles layouts, applies profiles, and wraps the command in logging/flags
-func LaunchLayout(host SearchableHost, layout string, cfg *Config) error {
-	sshArgs := ""
+// itermBackend drives iTerm2 through AppleScript. A whole tab is queued into a
+// single script and executed on Flush, so building a layout is one osascript call.
+type itermBackend struct {
+	firstCmd string
+	profile  string
+	body     []string
+}
 
-	// 1. Ignore Key Changes (Default is true if missing from YAML)
-	ignoreKeys := true
-	if cfg.Settings.IgnoreKeyChanges != nil {
-		ignoreKeys = *cfg.Settings.IgnoreKeyChanges
-	}
-	if ignoreKeys {
-		sshArgs += "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null "
-	}
+func (t *itermBackend) Name() string { return "iterm" }
 
-	// The base SSH command (without the logging wrapper)
-	baseSshCmd := fmt.Sprintf("ssh %s%s", sshArgs, host.Alias)
+func (t *itermBackend) OpenTab(host SearchableHost, cmd string) error {
+	t.firstCmd = cmd
+	t.profile = profileFor(host)
+	t.body = nil
+	return nil
+}
 
-	// 2. Fallback to iTerm's default profile if empty
-	profileStr := `default profile`
-	if host.Profile != "" {
-		profileStr = fmt.Sprintf(`profile "%s"`, host.Profile)
+func (t *itermBackend) SplitPane(from, to int, dir SplitDirection, percent int, host SearchableHost, cmd string) error {
+	direction, dimension := "horizontally", "rows"
+	if dir == SplitRight {
+		direction, dimension = "vertically", "columns"
 	}
 
-	// 3. Helper function to generate a unique command per pane
-	getCmdForPane := func(paneIndex int) string {
-		if !host.LogSession {
-			return baseSshCmd
-		}
-
-		homeDir, _ := os.UserHomeDir()
-		logDir := filepath.Join(homeDir, "wssh_logs")
-		os.MkdirAll(logDir, 0755)
-
-		timestamp := time.Now().Format("2006-01-02_15-04-05")
-		
-		logFile := filepath.Join(logDir, fmt.Sprintf("%s_%s_pane%d.log", host.Alias, timestamp, paneIndex))
-		
-		// Wrap the SSH command in the native macOS 'script' utility
-		return fmt.Sprintf("script -q \\\"%s\\\" %s", logFile, baseSshCmd)
+	// iTerm always splits in half, so remember the old size and shrink the pane afterwards
+	resize := percent != 50
+	if resize {
+		t.body = append(t.body, fmt.Sprintf("set size%d to %s of pane%d", to, dimension, from))
 	}
-
-	var script string
-
-	// 4. Generate the AppleScript based on the requested layout
-	switch layout {
-	case "2h": // 2 Horizontal
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				set newTab to (create tab with %s command "%s")
-				tell newTab
-					set pane1 to current session
-					set pane2 to (split horizontally with %s command "%s")
-				end tell
-			end tell
-		end tell`, profileStr, getCmdForPane(1), profileStr, getCmdForPane(2))
-
-	case "2v": // 2 Vertical
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				set newTab to (create tab with %s command "%s")
-				tell newTab
-					set pane1 to current session
-					set pane2 to (split vertically with %s command "%s")
-				end tell
-			end tell
-		end tell`, profileStr, getCmdForPane(1), profileStr, getCmdForPane(2))
-
-	case "3h": // 3 Horizontal
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				set newTab to (create tab with %s command "%s")
-				tell newTab
-					set pane1 to current session
-					set pane2 to (split horizontally with %s command "%s")
-					tell pane2
-						set pane3 to (split horizontally with %s command "%s")
-					end tell
-				end tell
-			end tell
-		end tell`, profileStr, getCmdForPane(1), profileStr, getCmdForPane(2), profileStr, getCmdForPane(3))
-
-	case "3v": // 3 Vertical
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				set newTab to (create tab with %s command "%s")
-				tell newTab
-					set pane1 to current session
-					set pane2 to (split vertically with %s command "%s")
-					tell pane2
-						set pane3 to (split vertically with %s command "%s")
-					end tell
-				end tell
-			end tell
-		end tell`, profileStr, getCmdForPane(1), profileStr, getCmdForPane(2), profileStr, getCmdForPane(3))
-
-	case "4g": // 2x2 Grid
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				set newTab to (create tab with %s command "%s")
-				tell newTab
-					set pane1 to current session
-					set pane2 to (split horizontally with %s command "%s")
-					set pane3 to (split vertically with %s command "%s")
-					tell pane1
-						set pane4 to (split vertically with %s command "%s")
-					end tell
-				end tell
-			end tell
-		end tell`, profileStr, getCmdForPane(1), profileStr, getCmdForPane(2), profileStr, getCmdForPane(3), profileStr, getCmdForPane(4))
-
-	default: // "single" or unrecognized input
-		script = fmt.Sprintf(`tell application "iTerm2"
-			tell current window
-				create tab with %s command "%s"
-			end tell
-		end tell`, profileStr, getCmdForPane(1))
+	t.body = append(t.body,
+		fmt.Sprintf("tell pane%d", from),
+		fmt.Sprintf("\tset pane%d to (split %s with %s command %s)", to, direction, profileFor(host), appleScriptString(cmd)),
+		"end tell",
+	)
+	if resize {
+		t.body = append(t.body, fmt.Sprintf("set %s of pane%d to (size%d * %d) div 100", dimension, from, to, 100-percent))
 	}
+	return nil
+}
 
-	// 5. Log the successful execution to your local history file
-	err := LogConnection(host.Alias)
-	if err != nil {
-		fmt.Printf("Warning: Failed to log connection history: %v\n", err)
+func (t *itermBackend) NameSession(pane int, name string) error {
+	t.body = append(t.body, fmt.Sprintf("set name of pane%d to %s", pane, appleScriptString(name)))
+	return nil
+}
+
+func (t *itermBackend) Flush() error {
+	var b strings.Builder
+	b.WriteString("tell application \"iTerm2\"\n")
+	b.WriteString("\ttell current window\n")
+	fmt.Fprintf(&b, "\t\tset newTab to (create tab with %s command %s)\n", t.profile, appleScriptString(t.firstCmd))
+	b.WriteString("\t\ttell newTab\n")
+	b.WriteString("\t\t\tset pane1 to current session\n")
+	for _, line := range t.body {
+		b.WriteString("\t\t\t" + line + "\n")
 	}
+	b.WriteString("\t\tend tell\n")
+	b.WriteString("\tend tell\n")
+	b.WriteString("end tell")
 
-	return ExecuteAppleScript(script)
+	t.body = nil
+	return ExecuteAppleScript(b.String())
 }
 
-// SendMacro injects text into the currently active iTerm pane and executes it
-func SendMacro(command string) error {
-	// Escape double quotes and backslashes so AppleScript doesn't break
-	safeCmd := strings.ReplaceAll(command, `\`, `\\`)
-	safeCmd = strings.ReplaceAll(safeCmd, `"`, `\"`)
+// Attach has nothing to do, iTerm shows every tab as it is created
+func (t *itermBackend) Attach() error { return nil }
 
+// SendText injects text into the currently active iTerm pane and executes it
+func (t *itermBackend) SendText(text string) error {
 	// The AppleScript targets the 'current session' and writes the text.
-	// We add \n at the end so it executes the command automatically.
+	// 'write text' adds the newline so it executes the command automatically.
 	script := fmt.Sprintf(`tell application "iTerm2"
 		tell current window
 			tell current session
-				write text "%s"
+				write text %s
 			end tell
 		end tell
-	end tell`, safeCmd)
+	end tell`, appleScriptString(text))
 
 	return ExecuteAppleScript(script)
 }
+
+// profileFor falls back to iTerm's default profile if the host has none
+func profileFor(host SearchableHost) string {
+	if host.Profile == "" {
+		return `default profile`
+	}
+	return "profile " + appleScriptString(host.Profile)
+}
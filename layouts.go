@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// defaultTileMaxPanes caps how many hosts `--layout auto` packs into one tab
+const defaultTileMaxPanes = 9
+
+// builtinLayouts are always available. A layout of the same name under
+// `layouts:` in ~/.wssh.yaml replaces the built-in one.
+var builtinLayouts = map[string]Layout{
+	"single": {Description: "Standard pane", Rows: []Row{{Panes: 1}}},
+	"2h":     {Description: "Two horizontal panes", Rows: []Row{{Panes: 1}, {Panes: 1}}},
+	"2v":     {Description: "Two vertical panes", Rows: []Row{{Panes: 2}}},
+	"3h":     {Description: "Three horizontal panes", Rows: []Row{{Panes: 1}, {Panes: 1}, {Panes: 1}}},
+	"3v":     {Description: "Three vertical panes", Rows: []Row{{Panes: 3}}},
+	"4g":     {Description: "2x2 Grid", Rows: []Row{{Panes: 2}, {Panes: 2}}},
+}
+
+// builtinLayoutOrder keeps completions and listings in a familiar order
+var builtinLayoutOrder = []string{"single", "2h", "2v", "3h", "3v", "4g"}
+
+// ResolveLayout looks up a layout by name, preferring the config over the built-ins
+func ResolveLayout(name string, cfg *Config) (Layout, error) {
+	layout, exists := cfg.Layouts[name]
+	if !exists {
+		layout, exists = builtinLayouts[name]
+	}
+	if !exists {
+		return Layout{}, fmt.Errorf("unknown layout '%s' (available: %v)", name, LayoutNames(cfg))
+	}
+
+	if err := layout.validate(); err != nil {
+		return Layout{}, fmt.Errorf("layout '%s': %v", name, err)
+	}
+	return layout, nil
+}
+
+// LayoutNames returns the built-in layouts followed by the config-defined ones (sorted)
+func LayoutNames(cfg *Config) []string {
+	names := append([]string{}, builtinLayoutOrder...)
+
+	var custom []string
+	for name := range cfg.Layouts {
+		if _, isBuiltin := builtinLayouts[name]; !isBuiltin {
+			custom = append(custom, name)
+		}
+	}
+	sort.Strings(custom)
+
+	return append(names, custom...)
+}
+
+// LayoutDescription returns the description shown in completions and listings
+func LayoutDescription(name string, cfg *Config) string {
+	if l, exists := cfg.Layouts[name]; exists {
+		return l.Description
+	}
+	return builtinLayouts[name].Description
+}
+
+// AutoGridLayout builds a near-square grid for n panes, e.g. 5 -> rows of 3 and 2
+func AutoGridLayout(n int) (Layout, error) {
+	if n < 1 {
+		return Layout{}, fmt.Errorf("a grid needs at least 1 pane, got %d", n)
+	}
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	rows := int(math.Ceil(float64(n) / float64(cols)))
+
+	layout := Layout{Description: fmt.Sprintf("Auto grid for %d panes", n)}
+	remaining := n
+	for r := 0; r < rows; r++ {
+		panes := cols
+		if remaining < cols {
+			panes = remaining
+		}
+		layout.Rows = append(layout.Rows, Row{Panes: panes})
+		remaining -= panes
+	}
+	return layout, nil
+}
+
+// PaneCount is the total number of panes across all rows
+func (l Layout) PaneCount() int {
+	count := 0
+	for _, row := range l.Rows {
+		count += row.Panes
+	}
+	return count
+}
+
+// validate catches definitions we cannot turn into a split sequence
+func (l Layout) validate() error {
+	if len(l.Rows) == 0 {
+		return fmt.Errorf("no rows defined")
+	}
+	for i, row := range l.Rows {
+		if row.Panes < 1 {
+			return fmt.Errorf("row %d must have at least 1 pane", i+1)
+		}
+		if row.Size < 0 {
+			return fmt.Errorf("row %d has a negative size", i+1)
+		}
+		if len(row.Sizes) > 0 && len(row.Sizes) != row.Panes {
+			return fmt.Errorf("row %d has %d panes but %d sizes", i+1, row.Panes, len(row.Sizes))
+		}
+		if len(row.Commands) > row.Panes {
+			return fmt.Errorf("row %d has %d panes but %d commands", i+1, row.Panes, len(row.Commands))
+		}
+		for _, s := range row.Sizes {
+			if s < 1 {
+				return fmt.Errorf("row %d sizes must be positive", i+1)
+			}
+		}
+	}
+	return nil
+}
+
+// rowWeights returns the relative height of every row (defaulting to 1)
+func (l Layout) rowWeights() []int {
+	weights := make([]int, len(l.Rows))
+	for i, row := range l.Rows {
+		weights[i] = row.Size
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+	return weights
+}
+
+// paneWeights returns the relative width of every pane in the row (defaulting to 1)
+func (r Row) paneWeights() []int {
+	if len(r.Sizes) == r.Panes {
+		return r.Sizes
+	}
+	weights := make([]int, r.Panes)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weights
+}
+
+func sumInts(values []int) int {
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// Box-drawing characters by the directions their lines leave the cell in
+const (
+	armUp = 1 << iota
+	armDown
+	armLeft
+	armRight
+)
+
+var boxChars = map[int]rune{
+	armLeft | armRight:                   '─',
+	armUp | armDown:                      '│',
+	armDown | armRight:                   '┌',
+	armDown | armLeft:                    '┐',
+	armUp | armRight:                     '└',
+	armUp | armLeft:                      '┘',
+	armUp | armDown | armRight:           '├',
+	armUp | armDown | armLeft:            '┤',
+	armLeft | armRight | armDown:         '┬',
+	armLeft | armRight | armUp:           '┴',
+	armUp | armDown | armLeft | armRight: '┼',
+}
+
+// Preview draws the pane arrangement in a width x height box, honoring row and
+// pane sizes and numbering the panes in launch order:
+//
+//	┌─────┬─────┐
+//	│  1  │  2  │
+//	├─────┼─────┤
+//	│  3  │  4  │
+//	└─────┴─────┘
+func (l Layout) Preview(width, height int) string {
+	arms := make([][]int, height)
+	for y := range arms {
+		arms[y] = make([]int, width)
+	}
+	hline := func(y, x0, x1 int) {
+		for x := x0; x < x1; x++ {
+			arms[y][x] |= armRight
+			arms[y][x+1] |= armLeft
+		}
+	}
+	vline := func(x, y0, y1 int) {
+		for y := y0; y < y1; y++ {
+			arms[y][x] |= armDown
+			arms[y+1][x] |= armUp
+		}
+	}
+	// edges splits 0..size-1 into len(weights) parts proportional to the weights
+	edges := func(weights []int, size int) []int {
+		total := sumInts(weights)
+		bounds := []int{0}
+		sum := 0
+		for _, w := range weights {
+			sum += w
+			bounds = append(bounds, sum*(size-1)/total)
+		}
+		return bounds
+	}
+
+	type label struct {
+		x, y int
+		text string
+	}
+	var labels []label
+
+	hline(0, 0, width-1)
+	hline(height-1, 0, width-1)
+	vline(0, 0, height-1)
+	vline(width-1, 0, height-1)
+
+	rowEdges := edges(l.rowWeights(), height)
+	pane := 1
+	for r, row := range l.Rows {
+		top, bottom := rowEdges[r], rowEdges[r+1]
+		if r > 0 {
+			hline(top, 0, width-1)
+		}
+		paneEdges := edges(row.paneWeights(), width)
+		for p := range row.Panes {
+			left, right := paneEdges[p], paneEdges[p+1]
+			if p > 0 {
+				vline(left, top, bottom)
+			}
+			text := fmt.Sprint(pane)
+			labels = append(labels, label{(left + right + 1 - len(text)) / 2, (top + bottom) / 2, text})
+			pane++
+		}
+	}
+
+	grid := make([][]rune, height)
+	for y := range grid {
+		grid[y] = make([]rune, width)
+		for x := range grid[y] {
+			grid[y][x] = ' '
+			if c, ok := boxChars[arms[y][x]]; ok {
+				grid[y][x] = c
+			}
+		}
+	}
+	for _, lb := range labels {
+		for i, c := range lb.text {
+			// Panes too small for their number stay blank
+			if x := lb.x + i; x > 0 && x < width-1 && grid[lb.y][x] == ' ' {
+				grid[lb.y][x] = c
+			}
+		}
+	}
+
+	lines := make([]string, height)
+	for y, row := range grid {
+		lines[y] = string(row)
+	}
+	return strings.Join(lines, "\n")
+}
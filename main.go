@@ -3,37 +3,32 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 func main() {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatalf("Could not determine home directory: %v", err)
-	}
-	configPath := filepath.Join(homeDir, ".wssh.yaml")
-
-	// Ensure config exists (using the function from our previous steps)
-	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		generateDefaultConfig(configPath)
-		fmt.Printf("Created a default configuration file at: %s\n", configPath)
-		os.Exit(0)
-	}
-
-	// Capture the full 'cfg' object so we can access cfg.Macros
-	cfg, searchableHosts, err := LoadConfig(configPath)
-	if err != nil {
-		log.Fatalf("Error loading config from %s: %v", configPath, err)
-	}
+	// The commands below reach the config through these. It is found and loaded
+	// once the commands and flags are defined, since the command line decides
+	// which file (--config) and how (see requestedCommand).
+	var location ConfigLocation
+	var configPath string
+	cfg := &Config{}
+	var searchableHosts []SearchableHost
+
+	var tileLayout string
+	var inline bool
+	var dryRunFlag bool
+	var output string
 
 	var rootCmd = &cobra.Command{
 		Use:   "wssh [host] [layout]",
-		Short: "wssh is an iTerm2 SSH orchestrator",
+		Short: "wssh is an iTerm2 and tmux SSH orchestrator",
 		Args:  cobra.ArbitraryArgs,
 		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			if len(args) == 0 {
@@ -48,7 +43,12 @@ func main() {
 
 			// Autocomplete for the second argument (layouts)
 			if len(args) == 1 {
-				layouts := []string{"single\tStandard pane", "2h\tTwo horizontal panes", "2v\tTwo vertical panes", "3h\tThree horizontal panes", "3v\tThree vertical panes", "4g\t2x2 Grid"}
+				var layouts []string
+				for _, name := range LayoutNames(cfg) {
+					if strings.HasPrefix(name, toComplete) {
+						layouts = append(layouts, fmt.Sprintf("%s\t%s", name, LayoutDescription(name, cfg)))
+					}
+				}
 				return layouts, cobra.ShellCompDirectiveNoFileComp
 			}
 
@@ -63,26 +63,9 @@ func main() {
 
 			// No args? Open the TUI Menu!
 			if len(args) == 0 {
-				selectedHosts := RunTUI(searchableHosts)
-				if len(selectedHosts) > 0 {
-					// If only one host was selected (Enter), just connect
-					if len(selectedHosts) == 1 {
-						fmt.Printf("Connecting to %s...\n", selectedHosts[0].Alias)
-						err := LaunchLayout(selectedHosts[0], "single", cfg)
-						if err != nil {
-							log.Fatalf("Failed to launch session: %v", err)
-						}
-					} else {
-						// If multiple hosts were selected (ctrl+a), confirm first
-						if ConfirmExecution(selectedHosts, "Connect to") {
-							for _, h := range selectedHosts {
-								err := LaunchLayout(h, "single", cfg)
-								if err != nil {
-									fmt.Printf("❌ Failed to launch session for %s: %v\n", h.Alias, err)
-								}
-							}
-						}
-					}
+				action := RunTUI(searchableHosts, location.Context, cfg)
+				if err := RunTUIAction(action, tileLayout, inline, cfg); err != nil {
+					log.Fatalf("%v", err)
 				}
 				return
 			}
@@ -110,6 +93,14 @@ func main() {
 				targetHost = SearchableHost{Alias: hostAlias}
 			}
 
+			// Single sessions can replace wssh in the current terminal instead of opening a tab
+			if layout == "single" && useInline(inline, cfg) {
+				if err := ExecInline(targetHost, cfg); err != nil {
+					log.Fatalf("Failed to exec ssh: %v", err)
+				}
+				return
+			}
+
 			fmt.Printf("CLI Mode: Launching %s with layout '%s'\n", targetHost.Alias, layout)
 			err := LaunchLayout(targetHost, layout, cfg)
 			if err != nil {
@@ -120,7 +111,7 @@ func main() {
 
 	var macroCmd = &cobra.Command{
 		Use:   "macro [name]",
-		Short: "Inject a macro into the active iTerm session",
+		Short: "Inject a macro into the active terminal session",
 		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 			if len(args) != 0 {
 				return nil, cobra.ShellCompDirectiveNoFileComp
@@ -146,11 +137,11 @@ func main() {
 			macroName := args[0]
 			macroContent, exists := cfg.Macros[macroName]
 			if !exists {
-				log.Fatalf("Macro '%s' not found in ~/.wssh.yaml", macroName)
+				log.Fatalf("Macro '%s' not found in %s", macroName, shortPath(configPath))
 			}
 
-			// Send the text to iTerm!
-			err := SendMacro(macroContent)
+			// Send the text to the active pane!
+			err := SendMacro(macroContent, cfg)
 			if err != nil {
 				log.Fatalf("Failed to send macro: %v", err)
 			}
@@ -164,9 +155,360 @@ func main() {
 			err := CheckAndPrimeAgents(cfg)
 			if err != nil {
 				fmt.Println(err)
+				return
+			}
+			PrintAgentResolution(searchableHosts, cfg)
+		},
+	}
+
+	var initCmd = &cobra.Command{
+		Use:   "init",
+		Short: "Interactively create the config file, optionally seeded from ~/.ssh/config",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunInit(configPath); err != nil {
+				fmt.Printf("\nError: %v\n", err)
+			}
+		},
+	}
+
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and check the config file",
+	}
+
+	var strict bool
+	var validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check the config for errors and warnings (exits non-zero on errors)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			diagnostics, err := ValidateConfig(configPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			errs := PrintDiagnostics(diagnostics)
+			if errs > 0 || (strict && len(diagnostics) > 0) {
+				os.Exit(1)
+			}
+		},
+	}
+	validateCmd.Flags().BoolVar(&strict, "strict", false, "Also exit non-zero when there are warnings")
+	configCmd.AddCommand(validateCmd)
+
+	var merged bool
+	var showCmd = &cobra.Command{
+		Use:   "show",
+		Short: "Print the config, or with --merged the effective config and where each value comes from",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if merged {
+				if err := PrintMergedConfig(cfg); err != nil {
+					log.Fatalf("Failed to print config: %v", err)
+				}
+				return
+			}
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				log.Fatalf("Failed to read config: %v", err)
+			}
+			fmt.Print(string(data))
+		},
+	}
+	showCmd.Flags().BoolVar(&merged, "merged", false, "Merge in the included files and annotate values with their file")
+	configCmd.AddCommand(showCmd)
+
+	var yes bool
+	var restoreCmd = &cobra.Command{
+		Use:   "restore [number|id]",
+		Short: "List config backups, or roll the config and ~/.ssh/config back to one",
+		Args:  cobra.MaximumNArgs(1),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			backupDir, _ := backupSettings(cfg.Settings)
+			backups, _ := ListBackups(backupDir)
+			var completions []string
+			for _, b := range backups {
+				if strings.HasPrefix(b.ID, toComplete) {
+					completions = append(completions, fmt.Sprintf("%s\t%s", b.ID, b.Reason))
+				}
+			}
+			return completions, cobra.ShellCompDirectiveNoFileComp
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			choice := ""
+			if len(args) > 0 {
+				choice = args[0]
+			}
+			if err := RunRestore(cfg, choice, yes); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	restoreCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Restore without asking for confirmation")
+	configCmd.AddCommand(restoreCmd)
+
+	var contextCmd = &cobra.Command{
+		Use:   "context",
+		Short: "Switch between named configs (inventories, agent envs and macros)",
+		Run: func(cmd *cobra.Command, args []string) {
+			PrintContexts()
+		},
+	}
+	completeContexts := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) != 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return ListContexts(), cobra.ShellCompDirectiveNoFileComp
+	}
+	var contextListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List contexts, marking the active one",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			PrintContexts()
+		},
+	}
+	var contextCurrentCmd = &cobra.Command{
+		Use:   "current",
+		Short: "Print the active context and the config file in use",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("%s\t%s\n", CurrentContext(), shortPath(configPath))
+			if location.Source == "--config" || location.Source == envConfig {
+				fmt.Printf("(overridden by %s)\n", location.Source)
+			}
+		},
+	}
+	var contextUseCmd = &cobra.Command{
+		Use:               "use [name]",
+		Short:             "Make a context active ('default' for ~/.wssh.yaml)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeContexts,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := UseContext(args[0]); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Switched to context '%s'\n", args[0])
+		},
+	}
+	var copyCurrent bool
+	var contextCreateCmd = &cobra.Command{
+		Use:   "create [name]",
+		Short: "Create a context from the starter config (or a copy of the current one)",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			from := ""
+			if copyCurrent {
+				from = configPath
+			}
+			path, err := CreateContext(args[0], from)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Created context '%s' at %s\nActivate it with: wssh context use %s\n", args[0], shortPath(path), args[0])
+		},
+	}
+	contextCreateCmd.Flags().BoolVar(&copyCurrent, "copy", false, "Start from a copy of the current config")
+	contextCmd.AddCommand(contextListCmd, contextCurrentCmd, contextUseCmd, contextCreateCmd)
+
+	var importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Import hosts into the inventory from other sources",
+	}
+	var importGroup string
+	var importYes bool
+	var importSSHConfigCmd = &cobra.Command{
+		Use:   "ssh-config [path]",
+		Short: "Import the Host entries of ~/.ssh/config (or another ssh_config file)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := expandPath("~/.ssh/config")
+			if len(args) > 0 {
+				path = absPath(args[0])
+			}
+			if err := RunImportSSHConfig(cfg, path, importGroup, importYes); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+	importSSHConfigCmd.Flags().StringVar(&importGroup, "group", "", "Put every imported host in this group instead of proposing groups")
+	importSSHConfigCmd.Flags().BoolVarP(&importYes, "yes", "y", false, "Write without asking for confirmation")
+	importCmd.AddCommand(importSSHConfigCmd)
+
+	// Completion for the host and group commands
+	completeAliases := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var completions []string
+		for _, host := range searchableHosts {
+			if strings.HasPrefix(host.Alias, toComplete) {
+				completions = append(completions, fmt.Sprintf("%s\t%s", host.Alias, host.GroupName))
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+	completeGroups := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var completions []string
+		for _, g := range cfg.Groups {
+			if strings.HasPrefix(g.Name, toComplete) {
+				completions = append(completions, g.Name)
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+	exitOnError := func(err error) {
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	addEditFlags := func(cmd *cobra.Command, ef *editFlags, kind string) {
+		if kind == "host" {
+			cmd.Flags().StringVar(&ef.Hostname, "hostname", "", "FQDN or IP address")
+			cmd.Flags().StringVar(&ef.Notes, "notes", "", "Free text shown in the TUI detail pane (empty removes it)")
+		} else {
+			cmd.Flags().StringVar(&ef.Profile, "profile", "", "Terminal profile (empty removes it)")
+			cmd.Flags().BoolVar(&ef.LogSession, "log-session", false, "Log the sessions of the group's hosts")
+		}
+		cmd.Flags().StringVar(&ef.User, "user", "", "SSH user (empty removes it)")
+		cmd.Flags().StringVar(&ef.Port, "port", "", "SSH port (empty removes it)")
+		cmd.Flags().StringVar(&ef.IdentityFile, "identity-file", "", "Private key (empty removes it)")
+		cmd.Flags().StringVar(&ef.Jump, "jump", "", "ProxyJump hosts, inventory aliases work (empty removes it)")
+		cmd.Flags().StringVar(&ef.AgentEnv, "agent-env", "", "ssh_agent_envs entry to use (empty removes it)")
+		cmd.Flags().StringSliceVar(&ef.Tags, "tags", nil, "Replace the tags (comma separated, empty removes them)")
+		cmd.Flags().StringSliceVar(&ef.AddTags, "add-tag", nil, "Add tags")
+		cmd.Flags().StringSliceVar(&ef.RemoveTags, "remove-tag", nil, "Remove tags")
+		cmd.Flags().StringArrayVar(&ef.Options, "option", nil, "Set an ssh option, Key=Value (Key= removes it)")
+		cmd.Flags().StringSliceVar(&ef.Unset, "unset", nil, "Remove fields, e.g. --unset user,port")
+	}
+
+	var manageYes bool
+	var hostCmd = &cobra.Command{
+		Use:   "host",
+		Short: "Edit, remove, move or rename hosts in the inventory",
+	}
+	var hostEditFlags editFlags
+	var hostEditCmd = &cobra.Command{
+		Use:               "edit [alias]",
+		Short:             "Change a host's fields (prompts for them when no flag is given)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeAliases,
+		Run: func(cmd *cobra.Command, args []string) {
+			changes, err := hostEditFlags.changes(cmd.Flags().Changed)
+			exitOnError(err)
+			exitOnError(RunHostEdit(cfg, args[0], changes, manageYes))
+		},
+	}
+	addEditFlags(hostEditCmd, &hostEditFlags, "host")
+	var hostRmCmd = &cobra.Command{
+		Use:               "rm [alias...]",
+		Short:             "Remove hosts from the inventory",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeAliases,
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunHostRemove(cfg, args, manageYes))
+		},
+	}
+	var hostMvCmd = &cobra.Command{
+		Use:   "mv [alias...] [group]",
+		Short: "Move hosts to another group, creating it if needed",
+		Args:  cobra.MinimumNArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			hosts, _ := completeAliases(cmd, args, toComplete)
+			groups, _ := completeGroups(cmd, args, toComplete)
+			return append(hosts, groups...), cobra.ShellCompDirectiveNoFileComp
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunHostMove(cfg, args[:len(args)-1], args[len(args)-1], manageYes))
+		},
+	}
+	var hostRenameCmd = &cobra.Command{
+		Use:   "rename [alias] [new-alias]",
+		Short: "Rename a host, updating jump settings, layouts, ~/.ssh/config and the history",
+		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeAliases(cmd, args, toComplete)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunHostRename(cfg, args[0], args[1], manageYes))
+		},
+	}
+	hostCmd.AddCommand(hostEditCmd, hostRmCmd, hostMvCmd, hostRenameCmd)
+	hostCmd.PersistentFlags().BoolVarP(&manageYes, "yes", "y", false, "Write without asking for confirmation")
+
+	var groupCmd = &cobra.Command{
+		Use:   "group",
+		Short: "Edit, remove, merge or rename groups in the inventory",
+	}
+	var groupEditFlags editFlags
+	var groupEditCmd = &cobra.Command{
+		Use:               "edit [group]",
+		Short:             "Change a group's settings (prompts for them when no flag is given)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeGroups,
+		Run: func(cmd *cobra.Command, args []string) {
+			changes, err := groupEditFlags.changes(cmd.Flags().Changed)
+			exitOnError(err)
+			exitOnError(RunGroupEdit(cfg, args[0], changes, manageYes))
+		},
+	}
+	addEditFlags(groupEditCmd, &groupEditFlags, "group")
+	var groupRmCmd = &cobra.Command{
+		Use:               "rm [group]",
+		Short:             "Remove a group and its hosts",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeGroups,
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunGroupRemove(cfg, args[0], manageYes))
+		},
+	}
+	var groupMvCmd = &cobra.Command{
+		Use:               "mv [group] [target-group]",
+		Short:             "Move every host of a group into another group and remove it",
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: completeGroups,
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunGroupMove(cfg, args[0], args[1], manageYes))
+		},
+	}
+	var groupRenameCmd = &cobra.Command{
+		Use:   "rename [group] [new-name]",
+		Short: "Rename a group, updating the agent env rules that refer to it",
+		Args:  cobra.ExactArgs(2),
+		ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+			if len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+			return completeGroups(cmd, args, toComplete)
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			exitOnError(RunGroupRename(cfg, args[0], args[1], manageYes))
+		},
+	}
+	groupCmd.AddCommand(groupEditCmd, groupRmCmd, groupMvCmd, groupRenameCmd)
+	groupCmd.PersistentFlags().BoolVarP(&manageYes, "yes", "y", false, "Write without asking for confirmation")
+
+	var syncYes bool
+	var syncSSHConfigCmd = &cobra.Command{
+		Use:   "sync-ssh-config",
+		Short: "Regenerate the wssh block of ~/.ssh/config from the inventory",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := RunSyncSSHConfig(cfg, syncYes); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
 			}
 		},
 	}
+	syncSSHConfigCmd.Flags().BoolVarP(&syncYes, "yes", "y", false, "Write without asking for confirmation")
 
 	var historyCmd = &cobra.Command{
 		Use:   "history",
@@ -179,16 +521,37 @@ func main() {
 			}
 		},
 	}
+	var addSpec hostSpec
+	var addFrom string
 	var addCmd = &cobra.Command{
 		Use:   "add",
-		Short: "Interactively add a new host to config and SSH config",
+		Short: "Add hosts to the config and the wssh block of ~/.ssh/config (prompts unless flags are given)",
+		Example: `  wssh add
+  wssh add --alias prod-web-03 --hostname 10.0.4.13 --group production --tags web --env prod
+  wssh add --from hosts.csv --group staging`,
+		Args: cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			err := RunAddInteractive(cfg)
+			var err error
+			if addFrom != "" || addSpec.Alias != "" || addSpec.Hostname != "" || addSpec.Group != "" {
+				err = RunAdd(cfg, addSpec, addFrom)
+			} else {
+				err = RunAddInteractive(cfg)
+			}
 			if err != nil {
 				fmt.Printf("\nError adding host: %v\n", err)
+				os.Exit(1)
 			}
 		},
 	}
+	addCmd.Flags().StringVar(&addSpec.Alias, "alias", "", "Alias of the host")
+	addCmd.Flags().StringVar(&addSpec.Hostname, "hostname", "", "FQDN or IP address")
+	addCmd.Flags().StringVar(&addSpec.Group, "group", "", "Group to add to, created if needed (default group for --from)")
+	addCmd.Flags().StringSliceVar(&addSpec.Tags, "tags", nil, "Tags, comma separated")
+	addCmd.Flags().StringVar(&addSpec.Auth, "auth", "", "Auth type: key (default) or password")
+	addCmd.Flags().StringVar(&addSpec.Env, "env", "", "ssh_agent_envs entry to use for key auth")
+	addCmd.Flags().StringVar(&addSpec.User, "user", "", "SSH user")
+	addCmd.Flags().IntVar(&addSpec.Port, "port", 0, "SSH port")
+	addCmd.Flags().StringVar(&addFrom, "from", "", "Add every host of a CSV or JSON file (- for stdin); the other flags fill in missing fields")
 
     // The direct CLI command
 	var pushCmd = &cobra.Command{
@@ -212,7 +575,7 @@ func main() {
 			hostAlias := args[0]
 			
 			if len(cfg.Payloads) == 0 {
-				fmt.Println("❌ No payloads configured in ~/.wssh.yaml.")
+				fmt.Printf("❌ No payloads configured in %s.\n", shortPath(configPath))
 				fmt.Println("Press Enter to return...")
 				bufio.NewReader(os.Stdin).ReadBytes('\n')
 				return
@@ -290,15 +653,19 @@ func main() {
 		},
 	}
 	var runCmd = &cobra.Command{
-		Use:   "run [script.sh] [search-terms...]",
+		Use:   "run [script.sh] [query...]",
 		Short: "Stream and execute a local script on multiple remote hosts",
 		Args:  cobra.MinimumNArgs(2), // Changed from ExactArgs(2)
 		Run: func(cmd *cobra.Command, args []string) {
 			scriptPath := args[0]
 			searchTerms := args[1:]
 			
-			matchedHosts := FindHosts(searchTerms, searchableHosts)
-			
+			matchedHosts, err := FindHosts(searchTerms, searchableHosts)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
 			if ConfirmExecution(matchedHosts, fmt.Sprintf("Run '%s'", scriptPath)) {
 				for _, host := range matchedHosts {
 					// You can run these sequentially, or wrap this in a goroutine/WaitGroup 
@@ -312,17 +679,19 @@ func main() {
 		},
 	}
 	var listCmd = &cobra.Command{
-		Use:   "list [search-terms...]",
-		Short: "List all hosts or search using multiple terms (AND logic)",
+		Use:   "list [query...]",
+		Short: "List all hosts or search them (e.g. 'web prod -staging', 'group:db OR tag:pg', 'ip:10.20.0.0/16')",
 		Run: func(cmd *cobra.Command, args []string) {
-			// 1. Convert all arguments to lowercase search terms
-			var searchTerms []string = args // No need to convert here, FindHosts will handle it		
-			matchedHosts := FindHosts(searchTerms, searchableHosts)
-			ListHosts(matchedHosts)
+			matchedHosts, err := FindHosts(args, searchableHosts)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			ListHosts(matchedHosts, location.Context)
 		},
 	}
 	var connectCmd = &cobra.Command{
-		Use:   "connect [search-terms...]",
+		Use:   "connect [query...]",
 		Short: "Open SSH connections to multiple servers at once",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
@@ -332,38 +701,235 @@ func main() {
 				os.Exit(1)
 			}
 
-			// Find matching hosts using the utils engine
-			matchedHosts := FindHosts(args, searchableHosts)
+			// Find matching hosts using the query language
+			matchedHosts, err := FindHosts(args, searchableHosts)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
 
 			// Prompt to prevent iTerm pane flooding
 			if ConfirmExecution(matchedHosts, "Connect to") {
-				for _, host := range matchedHosts {
-					err := LaunchLayout(host, "single", cfg)
-					if err != nil {
-						fmt.Printf("❌ Failed to launch session for %s: %v\n", host.Alias, err)
-					}
-				}
+				ConnectHosts(matchedHosts, tileLayout, cfg)
 			}
 		},
 	}
+
+	// --layout tiles multiple hosts into panes instead of opening one tab each
+	completeTileLayout := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		completions := []string{"auto\tGrid sized to the number of hosts"}
+		for _, name := range LayoutNames(cfg) {
+			completions = append(completions, fmt.Sprintf("%s\t%s", name, LayoutDescription(name, cfg)))
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+	rootCmd.Flags().StringVarP(&tileLayout, "layout", "l", "", "Tile ctrl+a selections into panes using this layout (or 'auto')")
+	rootCmd.RegisterFlagCompletionFunc("layout", completeTileLayout)
+	rootCmd.Flags().BoolVarP(&inline, "inline", "i", false, "Run single sessions in the current terminal instead of a new tab")
+	connectCmd.Flags().StringVarP(&tileLayout, "layout", "l", "", "Tile the matched hosts into panes using this layout (or 'auto')")
+	connectCmd.RegisterFlagCompletionFunc("layout", completeTileLayout)
+
+	// Global flags: --dry-run prints what would be executed instead of running it
+	// --config is read with peekFlags, the config is loaded before cobra parses the flags
+	rootCmd.PersistentFlags().String("config", "", "Config file to use (default: $WSSH_CONFIG, the active context, or ~/.wssh.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&dryRunFlag, "dry-run", false, "Print the AppleScript, ssh/scp commands and log files instead of executing them")
+	rootCmd.PersistentFlags().StringVar(&output, "output", "text", "Output format for --dry-run plans (text or json)")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if dryRunFlag && dryRun == nil {
+			EnableDryRun(output)
+		}
+	}
+
 	rootCmd.AddCommand(listCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(captureCmd)
 	rootCmd.AddCommand(pushMenuCmd)
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(initCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(contextCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(syncSSHConfigCmd)
+	rootCmd.AddCommand(hostCmd)
+	rootCmd.AddCommand(groupCmd)
 	rootCmd.AddCommand(historyCmd)
 	rootCmd.AddCommand(authCmd)
 	rootCmd.AddCommand(macroCmd)
 	rootCmd.AddCommand(connectCmd)	
 
+	// Now that the commands and flags are known, the config can be found and
+	// created or loaded
+	flags := peekFlags(rootCmd, os.Args[1:])
+	configFlag, _ := flags.GetString("config")
+	var err error
+	location, err = ResolveConfigLocation(configFlag)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	configPath = location.Path
+	cfg.path = configPath
+
+	// Child processes (e.g. 'wssh pushmenu' from the TUI) must use the same config
+	os.Setenv(envConfig, configPath)
+
+	command := requestedCommand(rootCmd)
+
+	// --dry-run must already be active if the first run would write a starter config
+	if set, _ := flags.GetBool("dry-run"); set {
+		format, _ := flags.GetString("output")
+		EnableDryRun(format)
+	}
+
+	// First run: create a starter config (or walk through 'wssh init') and carry on
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		ensureConfig(configPath, command)
+	}
+
+	if _, err := os.Stat(configPath); err == nil {
+		cfg, searchableHosts, err = LoadConfig(configPath)
+		if err != nil && command == "config" {
+			// 'wssh config validate' reports the error itself, with its position
+			cfg, searchableHosts = &Config{path: configPath}, nil
+		} else if err != nil {
+			log.Fatalf("Error loading config from %s: %v", configPath, err)
+		}
+		// 'config' subcommands report these themselves, completion must stay quiet
+		if command != "config" && !strings.HasPrefix(command, "__complete") {
+			for _, w := range cfg.warnings {
+				fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+			}
+		}
+	}
+
+	// The config supplies the --layout default
+	tileLayout = cfg.Settings.TileLayout
+	rootCmd.Flags().Lookup("layout").DefValue = tileLayout
+	connectCmd.Flags().Lookup("layout").DefValue = tileLayout
+
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+
+	if err := FinishDryRun(); err != nil {
+		log.Fatalf("Failed to print dry-run plan: %v", err)
+	}
+}
+
+// ensureConfig creates the config on first run. Interactive users are offered
+// 'wssh init', everyone else gets the documented starter file.
+func ensureConfig(configPath, command string) {
+
+	switch {
+	case command == "init":
+		// 'wssh init' writes the file itself
+		return
+	case command == "context":
+		// Switching contexts doesn't need the current one to exist
+		return
+	case strings.HasPrefix(command, "__complete"):
+		// Shell completion must not print or write anything, it works without a config
+		return
+	case dryRun != nil:
+		// Only show the write as part of the plan
+		if err := generateDefaultConfig(configPath); err != nil {
+			log.Fatalf("Could not create %s: %v", configPath, err)
+		}
+		return
+	case isInteractive():
+		fmt.Printf("No configuration found at %s.\n", configPath)
+		fmt.Print("Run the interactive setup now? (Y/n): ")
+		answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if err == nil && (answer == "" || answer == "y" || answer == "yes") {
+			if err := RunInit(configPath); err != nil {
+				log.Fatalf("Setup failed: %v", err)
+			}
+			fmt.Println()
+			return
+		}
+	}
+
+	if err := generateDefaultConfig(configPath); err != nil {
+		log.Fatalf("Could not create %s: %v", configPath, err)
+	}
+	fmt.Printf("Created a default configuration file at: %s\n\n", configPath)
 }
 
-// Keep your existing generateDefaultConfig function down here...
-func generateDefaultConfig(path string) {
-	// (Your existing implementation)
+// requestedCommand returns the first positional argument (a subcommand or host alias).
+// The config is loaded before cobra parses the flags, so we peek at os.Args and
+// skip the values of the root command's flags, as cobra would.
+func requestedCommand(root *cobra.Command) string {
+	flags := root.LocalFlags() // The root's own flags and the global ones
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+			return ""
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			return arg
+		}
+		if strings.Contains(arg, "=") {
+			continue
+		}
+
+		// In a group of short flags (-il) only the last one can take a value
+		f := flags.Lookup(strings.TrimPrefix(arg, "--"))
+		if !strings.HasPrefix(arg, "--") {
+			f = flags.ShorthandLookup(arg[len(arg)-1:])
+		}
+		if f != nil && f.NoOptDefVal == "" {
+			i++ // Skip the flag's value
+		}
+	}
+	return ""
 }
+
+// peekFlags parses args with the flags of the command they run, the way cobra
+// will in Execute, for the global flags needed before that: --config picks the
+// file to load, and --dry-run keeps a first run from writing one. The flags are
+// copied, so cobra still parses the command line from scratch.
+func peekFlags(root *cobra.Command, args []string) *pflag.FlagSet {
+	cmd, rest, err := root.Find(args)
+	if err != nil {
+		cmd, rest = root, args
+	}
+
+	cmd.InitDefaultHelpFlag() // Execute adds it too, pflag stops at an unknown --help
+	flags := pflag.NewFlagSet(cmd.Name(), pflag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	copyFlag := func(f *pflag.Flag) {
+		if flags.Lookup(f.Name) != nil {
+			return
+		}
+		shorthand := f.Shorthand
+		if flags.ShorthandLookup(shorthand) != nil {
+			shorthand = ""
+		}
+		c := flags.VarPF(&peekedValue{value: f.DefValue, kind: f.Value.Type()}, f.Name, shorthand, f.Usage)
+		c.NoOptDefVal = f.NoOptDefVal
+	}
+	cmd.LocalFlags().VisitAll(copyFlag)
+	cmd.InheritedFlags().VisitAll(copyFlag)
+
+	if !cmd.DisableFlagParsing {
+		flags.Parse(rest) // cobra reports the errors
+	}
+	return flags
+}
+
+// peekedValue holds a flag value parsed by peekFlags, as text
+type peekedValue struct {
+	value string
+	kind  string
+}
+
+func (v *peekedValue) String() string     { return v.value }
+func (v *peekedValue) Set(s string) error { v.value = s; return nil }
+func (v *peekedValue) Type() string       { return v.kind }
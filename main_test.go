@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// peekTestCommands mirrors the flags of wssh's root command and two subcommands
+func peekTestCommands() *cobra.Command {
+	run := func(*cobra.Command, []string) {}
+	root := &cobra.Command{Use: "wssh", Args: cobra.ArbitraryArgs, Run: run}
+	root.PersistentFlags().String("config", "", "")
+	root.PersistentFlags().Bool("dry-run", false, "")
+	root.PersistentFlags().String("output", "text", "")
+	root.Flags().StringP("layout", "l", "", "")
+	root.Flags().BoolP("inline", "i", false, "")
+
+	connect := &cobra.Command{Use: "connect", Run: run}
+	connect.Flags().StringP("layout", "l", "", "")
+	add := &cobra.Command{Use: "add", Run: run}
+	add.Flags().String("alias", "", "")
+	add.Flags().StringSlice("tags", nil, "")
+	add.Flags().BoolP("yes", "y", false, "")
+	root.AddCommand(connect, add)
+	return root
+}
+
+func TestPeekFlags(t *testing.T) {
+	tests := []struct {
+		args   string
+		config string
+		dryRun bool
+		output string
+	}{
+		{args: "", output: "text"},
+		{args: "--config a.yaml list", config: "a.yaml", output: "text"},
+		{args: "--config=a.yaml", config: "a.yaml", output: "text"},
+		{args: "connect web --config a.yaml", config: "a.yaml", output: "text"},
+		{args: "add --tags a,b --config=a.yaml -y", config: "a.yaml", output: "text"},
+
+		// Values of other flags are not flags
+		{args: "connect --layout --config web", output: "text"},
+		{args: "-il --config a.yaml", output: "text"},
+		{args: "add --alias --config --dry-run", dryRun: true, output: "text"},
+
+		// Nothing after -- is a flag
+		{args: "connect -- --config a.yaml", output: "text"},
+		{args: "--config a.yaml -- --config b.yaml", config: "a.yaml", output: "text"},
+
+		// The last value wins, like in cobra
+		{args: "--config a.yaml --config b.yaml", config: "b.yaml", output: "text"},
+
+		{args: "--dry-run", dryRun: true, output: "text"},
+		{args: "--dry-run=false", output: "text"},
+		{args: "connect web --dry-run --output json", dryRun: true, output: "json"},
+		{args: "--output=json", output: "json"},
+
+		// Unknown flags (--help, typos) and completion requests still parse
+		{args: "connect --help --config a.yaml", config: "a.yaml", output: "text"},
+		{args: "__complete connect --config a.yaml ", config: "a.yaml", output: "text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			flags := peekFlags(peekTestCommands(), strings.Split(tt.args, " "))
+			config, _ := flags.GetString("config")
+			dryRun, _ := flags.GetBool("dry-run")
+			output, _ := flags.GetString("output")
+			if config != tt.config || dryRun != tt.dryRun || output != tt.output {
+				t.Errorf("peekFlags(%q) = config %q, dry-run %v, output %q; want %q, %v, %q",
+					tt.args, config, dryRun, output, tt.config, tt.dryRun, tt.output)
+			}
+		})
+	}
+}
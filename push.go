@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
@@ -30,38 +29,29 @@ func RunPushInstall(payloadAlias, hostAlias string, cfg *Config) error {
 		return fmt.Errorf("payload file does not exist: %s", localFilePath)
 	}
 
-	// 2. Gather global SSH args
-	sshArgs := []string{}
-	ignoreKeys := true
-	if cfg.Settings.IgnoreKeyChanges != nil {
-		ignoreKeys = *cfg.Settings.IgnoreKeyChanges
-	}
-	if ignoreKeys {
-		sshArgs = append(sshArgs, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
-	}
+	// 2. Look up the host so scp and ssh get its settings and agent socket
+	host := cfg.LookupHost(hostAlias)
 
 	// 3. Generate a clean remote filename (e.g., dotfiles.tgz)
 	remoteFileName := fmt.Sprintf("%s.tgz", payloadAlias)
 	fmt.Printf("📦 Uploading %s to %s as %s...\n", localFilePath, hostAlias, remoteFileName)
 
 	// 4. Execute SCP
-	scpArgs := append(sshArgs, localFilePath, fmt.Sprintf("%s:%s", hostAlias, remoteFileName))
-	scpCmd := exec.Command("scp", scpArgs...)
+	scpCmd := NewSCP(host, cfg, localFilePath, remoteFileName).Cmd()
 	scpCmd.Stdout = os.Stdout
 	scpCmd.Stderr = os.Stderr
-	if err := scpCmd.Run(); err != nil {
+	if err := runCommand(scpCmd); err != nil {
 		return fmt.Errorf("SCP failed: %v", err)
 	}
 
 	// 5. Execute SSH to untar (Notice we don't delete the file after extraction) 
 	fmt.Printf("⚙️  Extracting %s on %s (archive will remain on host)...\n", remoteFileName, hostAlias)
-	remoteCmd := fmt.Sprintf("tar -xzf %s -C ~/", remoteFileName)
-	
-	sshRunArgs := append(sshArgs, hostAlias, remoteCmd)
-	sshCmd := exec.Command("ssh", sshRunArgs...)
+	remoteCmd := fmt.Sprintf("tar -xzf %s -C ~/", shellQuote(remoteFileName))
+
+	sshCmd := NewSSH(host, cfg, remoteCmd).Cmd()
 	sshCmd.Stdout = os.Stdout
 	sshCmd.Stderr = os.Stderr
-	if err := sshCmd.Run(); err != nil {
+	if err := runCommand(sshCmd); err != nil {
 		return fmt.Errorf("remote extraction failed: %v", err)
 	}
 
@@ -77,6 +67,9 @@ func RunPushInstall(payloadAlias, hostAlias string, cfg *Config) error {
 
 // LogPushConnection appends the push event to the tracking file
 func LogPushConnection(alias, filename string) error {
+	if dryRun != nil {
+		return nil
+	}
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return err
@@ -0,0 +1,500 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// The host search language shared by list, connect, run and the TUI filter:
+//
+//	web prod             both terms must match (AND)
+//	web OR db, web | db  either side matches
+//	-staging, NOT staging  negation, also -group:staging and -(a b)
+//	(web | db) prod      parentheses group terms
+//	"prod east"          quoted phrase, matched as a substring
+//	group:prod           field qualifiers: alias:, host:, group:, tag:, ip:
+//	web-*, alias:/^db-\d+$/   globs and /regexes/
+//	ip:10.20.0.0/16      CIDR (or a single address) against IP hostnames
+//
+// A bare term matches a host when it equals the alias, hostname, group or a tag,
+// is a prefix of one, or appears in one as whole words ("db" matches "prod-db-01"
+// but not "prod-dbproxy"). Letters and digits are separate words, so "web" also
+// matches "prod-web01". A qualified term must match the whole field, unless it
+// is a glob or regex. Everything is case-insensitive.
+//
+// The TUI filter (ParseFilterQuery) is looser for bare terms, which match
+// anywhere inside a value ("eas" matches "prod-east-01") as it is typed, and
+// fall back to fuzzy matching on the alias when nothing else matches ("pdb").
+
+// queryFields are the field qualifiers, with their accepted spellings
+var queryFields = map[string]string{
+	"alias":    "alias",
+	"host":     "host",
+	"hostname": "host",
+	"group":    "group",
+	"tag":      "tag",
+	"tags":     "tag",
+	"ip":       "ip",
+}
+
+// Query is a parsed search
+type Query struct {
+	text string
+	root queryNode
+}
+
+type queryNode interface {
+	match(h *SearchableHost) bool
+}
+
+type andNode []queryNode
+type orNode []queryNode
+type notNode struct{ node queryNode }
+
+func (n andNode) match(h *SearchableHost) bool {
+	for _, c := range n {
+		if !c.match(h) {
+			return false
+		}
+	}
+	return true
+}
+
+func (n orNode) match(h *SearchableHost) bool {
+	for _, c := range n {
+		if c.match(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n notNode) match(h *SearchableHost) bool {
+	return !n.node.match(h)
+}
+
+// termNode is one search term, optionally limited to a field
+type termNode struct {
+	field  string // "" for any field, else a queryFields value
+	value  string // Lowercased
+	phrase bool   // Quoted: substring match
+	substr bool   // Bare term in the TUI filter: substring match
+	fuzzy  bool   // TUI filter term without any hits: fuzzy match on the alias (see Rank)
+	glob   bool
+	re     *regexp.Regexp
+	prefix netip.Prefix // ip: CIDR
+	addr   netip.Addr   // ip: single address
+}
+
+func (t *termNode) match(h *SearchableHost) bool {
+	if t.fuzzy && len(fuzzy.Find(t.value, []string{h.Alias})) > 0 {
+		return true
+	}
+	if t.field == "ip" {
+		return t.matchIP(h.Hostname)
+	}
+
+	var values []string
+	switch t.field {
+	case "alias":
+		values = []string{h.Alias}
+	case "host":
+		values = []string{h.Hostname}
+	case "group":
+		values = []string{h.GroupName}
+	case "tag":
+		values = h.Tags
+	default:
+		values = append([]string{h.Alias, h.Hostname, h.GroupName}, h.Tags...)
+	}
+	for _, v := range values {
+		if t.matchValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *termNode) matchValue(v string) bool {
+	v = strings.ToLower(v)
+	switch {
+	case t.re != nil:
+		return t.re.MatchString(v)
+	case t.glob:
+		ok, _ := path.Match(t.value, v)
+		return ok
+	case t.phrase, t.substr:
+		return strings.Contains(v, t.value)
+	case t.field != "":
+		return v == t.value
+	default:
+		return strings.HasPrefix(v, t.value) || containsWords(v, t.value)
+	}
+}
+
+func (t *termNode) matchIP(hostname string) bool {
+	if t.re != nil || t.glob {
+		return t.matchValue(hostname)
+	}
+	addr, err := netip.ParseAddr(hostname)
+	if err != nil {
+		return false // Only literal addresses, names are not resolved
+	}
+	if t.prefix.IsValid() {
+		return t.prefix.Contains(addr.Unmap())
+	}
+	return addr.Unmap() == t.addr.Unmap()
+}
+
+// containsWords reports whether term appears in v on word boundaries. Words are
+// runs of letters or runs of digits, so "web" is a word of "prod-web01"
+func containsWords(v, term string) bool {
+	return wordIndex(v, term) >= 0
+}
+
+// wordIndex returns where term first appears in v on word boundaries, or -1
+func wordIndex(v, term string) int {
+	if term == "" {
+		return -1
+	}
+	for i := 0; i+len(term) <= len(v); {
+		j := strings.Index(v[i:], term)
+		if j < 0 {
+			return -1
+		}
+		start, end := i+j, i+j+len(term)
+		if wordBoundary(v, start) && wordBoundary(v, end) {
+			return start
+		}
+		_, size := utf8.DecodeRuneInString(v[start:])
+		i = start + size
+	}
+	return -1
+}
+
+// wordBoundary reports whether a word starts or ends at byte offset i of v
+func wordBoundary(v string, i int) bool {
+	if i == 0 || i == len(v) {
+		return true
+	}
+	before, _ := utf8.DecodeLastRuneInString(v[:i])
+	after, _ := utf8.DecodeRuneInString(v[i:])
+	a, b := charClass(before), charClass(after)
+	return a == 0 || b == 0 || a != b
+}
+
+// charClass is 1 for letters, 2 for digits and 0 for separators
+func charClass(r rune) int {
+	switch {
+	case unicode.IsLetter(r):
+		return 1
+	case unicode.IsDigit(r):
+		return 2
+	}
+	return 0
+}
+
+// Match reports whether the host matches the query. An empty query matches everything.
+func (q *Query) Match(h SearchableHost) bool {
+	return q.root.match(&h)
+}
+
+// Filter returns the matching hosts, in their original order (see Rank for best first)
+func (q *Query) Filter(hosts []SearchableHost) []SearchableHost {
+	var matches []SearchableHost
+	for _, h := range hosts {
+		if q.Match(h) {
+			matches = append(matches, h)
+		}
+	}
+	return matches
+}
+
+func (q *Query) String() string {
+	return q.text
+}
+
+// QueryFromArgs parses command line arguments as one query. Quote the query
+// (or put it after --) when it starts with a negation or uses parentheses.
+func QueryFromArgs(args []string) (*Query, error) {
+	return ParseQuery(strings.Join(args, " "))
+}
+
+// --- Parser ---
+
+const (
+	tokTerm = iota
+	tokOr
+	tokNot
+	tokOpen
+	tokClose
+)
+
+type queryToken struct {
+	kind   int
+	field  string
+	text   string
+	phrase bool
+	regex  bool
+}
+
+// ParseQuery parses a search. Unclosed quotes, regexes and parentheses are
+// closed at the end, so a query being typed in the TUI is always usable.
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := tokenizeQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected ')' in query")
+	}
+	return &Query{text: text, root: root}, nil
+}
+
+// ParseFilterQuery parses a search typed into the TUI filter, where bare terms
+// match anywhere inside a value
+func ParseFilterQuery(text string) (*Query, error) {
+	q, err := ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	q.walkTerms(func(t *termNode) {
+		if t.field == "" && t.re == nil && !t.glob {
+			t.substr = true
+		}
+	})
+	return q, nil
+}
+
+// walkTerms calls fn for every term of the query, negated ones included
+func (q *Query) walkTerms(fn func(t *termNode)) {
+	var walk func(n queryNode)
+	walk = func(n queryNode) {
+		switch n := n.(type) {
+		case andNode:
+			for _, c := range n {
+				walk(c)
+			}
+		case orNode:
+			for _, c := range n {
+				walk(c)
+			}
+		case notNode:
+			walk(n.node)
+		case *termNode:
+			fn(n)
+		}
+	}
+	walk(q.root)
+}
+
+var queryFieldPrefix = regexp.MustCompile(`^([A-Za-z]+):`)
+
+func tokenizeQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	rest := text
+	for {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		if rest == "" {
+			return tokens, nil
+		}
+
+		switch rest[0] {
+		case '(':
+			tokens = append(tokens, queryToken{kind: tokOpen})
+			rest = rest[1:]
+			continue
+		case ')':
+			tokens = append(tokens, queryToken{kind: tokClose})
+			rest = rest[1:]
+			continue
+		case '|':
+			tokens = append(tokens, queryToken{kind: tokOr})
+			rest = rest[1:]
+			continue
+		case '-':
+			// A lone "-" is a negation still being typed
+			if len(rest) > 1 && !unicode.IsSpace(rune(rest[1])) {
+				tokens = append(tokens, queryToken{kind: tokNot})
+			}
+			rest = rest[1:]
+			continue
+		}
+
+		tok := queryToken{kind: tokTerm}
+		if m := queryFieldPrefix.FindStringSubmatch(rest); m != nil {
+			field, known := queryFields[strings.ToLower(m[1])]
+			if !known {
+				return nil, fmt.Errorf("unknown field '%s:' (expected alias, host, group, tag or ip)", m[1])
+			}
+			tok.field = field
+			rest = rest[len(m[0]):]
+		}
+
+		switch {
+		case strings.HasPrefix(rest, `"`):
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			tok.text, tok.phrase = rest[1:1+end], true
+			rest = rest[min(end+2, len(rest)):]
+		case strings.HasPrefix(rest, "/"):
+			end := closingSlash(rest[1:])
+			tok.text, tok.regex = rest[1:1+end], true
+			rest = rest[min(end+2, len(rest)):]
+		default:
+			end := strings.IndexFunc(rest, func(r rune) bool { return unicode.IsSpace(r) || r == '(' || r == ')' || r == '|' })
+			if end < 0 {
+				end = len(rest)
+			}
+			tok.text, rest = rest[:end], rest[end:]
+			switch {
+			case tok.field != "":
+			case tok.text == "OR":
+				tok = queryToken{kind: tokOr}
+			case tok.text == "NOT":
+				tok = queryToken{kind: tokNot}
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+// closingSlash finds the unescaped / ending a regex, or the end of the text
+func closingSlash(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '/':
+			return i
+		}
+	}
+	return len(s)
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseOr: and ( OR and )*
+func (p *queryParser) parseOr() (queryNode, error) {
+	var alternatives orNode
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, n)
+		if tok, ok := p.peek(); !ok || tok.kind != tokOr {
+			break
+		}
+		p.pos++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return alternatives, nil
+}
+
+// parseAnd: unary*, up to OR, ')' or the end
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var terms andNode
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokOr || tok.kind == tokClose {
+			break
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, n)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+// parseUnary: -unary | ( or ) | term
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok, _ := p.peek()
+	p.pos++
+	switch tok.kind {
+	case tokNot:
+		if next, ok := p.peek(); !ok || next.kind == tokOr || next.kind == tokClose {
+			return andNode{}, nil // A trailing "-" while typing
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case tokOpen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok := p.peek(); ok && tok.kind == tokClose {
+			p.pos++
+		}
+		return n, nil
+	}
+	return newTermNode(tok)
+}
+
+func newTermNode(tok queryToken) (queryNode, error) {
+	t := &termNode{field: tok.field, value: strings.ToLower(tok.text), phrase: tok.phrase}
+	switch {
+	case tok.regex:
+		re, err := regexp.Compile("(?i)" + tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("bad regex /%s/: %v", tok.text, err)
+		}
+		t.re = re
+	case !tok.phrase && strings.ContainsAny(tok.text, "*?["):
+		if _, err := path.Match(t.value, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern '%s': %v", tok.text, err)
+		}
+		t.glob = true
+	case t.field == "ip":
+		if prefix, err := netip.ParsePrefix(tok.text); err == nil {
+			t.prefix = prefix.Masked()
+		} else if addr, err := netip.ParseAddr(tok.text); err == nil {
+			t.addr = addr
+		} else if tok.text != "" {
+			return nil, fmt.Errorf("bad ip '%s' (expected an address or CIDR like 10.20.0.0/16)", tok.text)
+		}
+	case t.field == "" && !tok.phrase:
+		// A bare CIDR searches IP hostnames
+		if prefix, err := netip.ParsePrefix(tok.text); err == nil {
+			t.field, t.prefix = "ip", prefix.Masked()
+		}
+	}
+	if t.value == "" && t.re == nil {
+		return andNode{}, nil // "group:" while typing matches everything
+	}
+	return t, nil
+}
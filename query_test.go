@@ -0,0 +1,237 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var queryTestHosts = []SearchableHost{
+	{Alias: "prod-east-01", Hostname: "10.20.1.5", GroupName: "prod", Tags: []string{"web", "nginx"}},
+	{Alias: "prod-db-01", Hostname: "10.20.2.7", GroupName: "prod", Tags: []string{"db", "pg"}},
+	{Alias: "prod-dbproxy", Hostname: "10.30.0.1", GroupName: "prod", Tags: []string{"proxy"}},
+	{Alias: "staging-web-01", Hostname: "staging-web.example.com", GroupName: "staging", Tags: []string{"web"}},
+	{Alias: "dev-db-01", Hostname: "10.99.0.1", GroupName: "dev", Tags: []string{"db", "Primary Replica"}},
+}
+
+// matchAliases returns the aliases of the hosts matching q, in config order
+func matchAliases(q *Query) []string {
+	var aliases []string
+	for _, h := range q.Filter(queryTestHosts) {
+		aliases = append(aliases, h.Alias)
+	}
+	return aliases
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Bare terms: whole value, prefix or whole words
+		{"", []string{"prod-east-01", "prod-db-01", "prod-dbproxy", "staging-web-01", "dev-db-01"}},
+		{"prod-db-01", []string{"prod-db-01"}},
+		{"db", []string{"prod-db-01", "dev-db-01"}},
+		{"DB", []string{"prod-db-01", "dev-db-01"}},
+		{"prod-db", []string{"prod-db-01", "prod-dbproxy"}},
+		{"eas", nil},
+		{"staging-web.example", []string{"staging-web-01"}},
+		{"10.20", []string{"prod-east-01", "prod-db-01"}},
+
+		// AND, OR and parentheses
+		{"web prod", []string{"prod-east-01"}},
+		{"web OR db", []string{"prod-east-01", "prod-db-01", "staging-web-01", "dev-db-01"}},
+		{"proxy | staging", []string{"prod-dbproxy", "staging-web-01"}},
+		{"(web | db) prod", []string{"prod-east-01", "prod-db-01"}},
+		{"prod db OR staging", []string{"prod-db-01", "staging-web-01"}},
+		{"or", nil}, // Only the upper case spelling is an operator
+
+		// Negation
+		{"-staging", []string{"prod-east-01", "prod-db-01", "prod-dbproxy", "dev-db-01"}},
+		{"prod -db", []string{"prod-east-01", "prod-dbproxy"}},
+		{"NOT prod", []string{"staging-web-01", "dev-db-01"}},
+		{"-group:prod", []string{"staging-web-01", "dev-db-01"}},
+		{"-(web | proxy)", []string{"prod-db-01", "dev-db-01"}},
+		{"- -staging", []string{"prod-east-01", "prod-db-01", "prod-dbproxy", "dev-db-01"}},
+		{"--staging", []string{"staging-web-01"}},
+
+		// Quoted phrases are substrings, and keep spaces and operators
+		{`"eas"`, []string{"prod-east-01"}},
+		{`"primary replica"`, []string{"dev-db-01"}},
+		{`"web OR db"`, nil},
+		{`tag:"primary replica"`, []string{"dev-db-01"}},
+
+		// Field qualifiers match the whole field
+		{"group:prod", []string{"prod-east-01", "prod-db-01", "prod-dbproxy"}},
+		{"GROUP:Staging", []string{"staging-web-01"}},
+		{"group:pro", nil},
+		{"tag:db", []string{"prod-db-01", "dev-db-01"}},
+		{"tags:pg", []string{"prod-db-01"}},
+		{"alias:dev-db-01", []string{"dev-db-01"}},
+		{"host:10.30.0.1", []string{"prod-dbproxy"}},
+		{"hostname:10.30.0.1", []string{"prod-dbproxy"}},
+		{"alias:prod", nil},
+
+		// Globs and regexes
+		{"prod-*", []string{"prod-east-01", "prod-db-01", "prod-dbproxy"}},
+		{"alias:*-01", []string{"prod-east-01", "prod-db-01", "staging-web-01", "dev-db-01"}},
+		{"alias:/^[a-z]+-db-\\d+$/", []string{"prod-db-01", "dev-db-01"}},
+		{"/PROXY/", []string{"prod-dbproxy"}},
+		{"host:/\\.example\\.com$/", []string{"staging-web-01"}},
+
+		// IPs and CIDRs, names are never resolved
+		{"ip:10.20.0.0/16", []string{"prod-east-01", "prod-db-01"}},
+		{"ip:10.30.0.1", []string{"prod-dbproxy"}},
+		{"10.0.0.0/8", []string{"prod-east-01", "prod-db-01", "prod-dbproxy", "dev-db-01"}},
+		{"ip:10.20.0.0/16 -tag:pg", []string{"prod-east-01"}},
+		{"ip:0.0.0.0/0 staging", nil},
+
+		// Incomplete input while typing in the TUI still parses
+		{`"prod-ea`, []string{"prod-east-01"}},
+		{"(web | proxy", []string{"prod-east-01", "prod-dbproxy", "staging-web-01"}},
+		{"prod -", []string{"prod-east-01", "prod-db-01", "prod-dbproxy"}},
+		{"group:", []string{"prod-east-01", "prod-db-01", "prod-dbproxy", "staging-web-01", "dev-db-01"}},
+		{"/prox", []string{"prod-dbproxy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q) failed: %v", tt.query, err)
+			}
+			if got := matchAliases(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) matched %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		err   string
+	}{
+		{"colour:red", "unknown field 'colour:'"},
+		{"web )", "unexpected ')'"},
+		{"/[a-/", "bad regex"},
+		{"alias:/(/", "bad regex"},
+		{"prod-[", "bad pattern"},
+		{"ip:10.20.0", "bad ip"},
+		{"ip:example.com", "bad ip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := ParseQuery(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ParseQuery(%q) error = %v, want one containing %q", tt.query, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestQueryFromArgs(t *testing.T) {
+	q, err := QueryFromArgs([]string{"group:prod", "-db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"prod-east-01", "prod-dbproxy"}
+	if got := matchAliases(q); !reflect.DeepEqual(got, want) {
+		t.Errorf("matched %q, want %q", got, want)
+	}
+	if q.String() != "group:prod -db" {
+		t.Errorf("String() = %q", q.String())
+	}
+}
+
+// TestParseFilterQuery checks the TUI filter, where bare terms match substrings
+func TestParseFilterQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"eas", []string{"prod-east-01"}},
+		{"EAS", []string{"prod-east-01"}},
+		{"b-0", []string{"prod-db-01", "staging-web-01", "dev-db-01"}},
+		{"xampl", []string{"staging-web-01"}},
+		{"rod eas", []string{"prod-east-01"}},
+		{"prox | tagin", []string{"prod-dbproxy", "staging-web-01"}},
+		{"prod -eas", []string{"prod-db-01", "prod-dbproxy"}},
+		{"-rod", []string{"staging-web-01", "dev-db-01"}},
+
+		// Qualified terms, globs and CIDRs keep their exact rules
+		{"group:pro", nil},
+		{"tag:d", nil},
+		{"alias:prod-db*", []string{"prod-db-01", "prod-dbproxy"}},
+		{"10.20.0.0/16", []string{"prod-east-01", "prod-db-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseFilterQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseFilterQuery(%q) failed: %v", tt.query, err)
+			}
+			if got := matchAliases(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilterQuery(%q) matched %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseQueryLetterDigitWords checks that bare terms on the command line find
+// words that run into digits, as plain substring search used to
+func TestParseQueryLetterDigitWords(t *testing.T) {
+	hosts := []SearchableHost{
+		{Alias: "prod-db-01", GroupName: "prod"},
+		{Alias: "prod-web01", GroupName: "prod"},
+		{Alias: "prod-webproxy", GroupName: "prod"},
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"web", []string{"prod-web01"}},
+		{"db OR web", []string{"prod-db-01", "prod-web01"}},
+		{"01", []string{"prod-db-01", "prod-web01"}},
+		{"prod -web", []string{"prod-db-01", "prod-webproxy"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, h := range q.Filter(hosts) {
+				got = append(got, h.Alias)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) matched %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordIndex(t *testing.T) {
+	tests := []struct {
+		v, term string
+		want    int
+	}{
+		{"prod-db-01", "db", 5},
+		{"prod-dbproxy", "db", -1},
+		{"db", "db", 0},
+		{"dbdb-db", "db", 5},
+		{"prod-db-01", "db-01", 5},
+		{"prod-web01", "web", 5},
+		{"prod-web01", "01", 8},
+		{"web01", "web", 0},
+		{"web01", "eb", -1},
+		{"café-db", "db", 6},
+		{"prod-db-01", "", -1},
+	}
+	for _, tt := range tests {
+		if got := wordIndex(tt.v, tt.term); got != tt.want {
+			t.Errorf("wordIndex(%q, %q) = %d, want %d", tt.v, tt.term, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import "strings"
+
+// Generated commands pass through up to three interpreters: AppleScript parses the
+// string literal, the pane's shell splits the command line, and for remote commands
+// the remote shell parses it again. Each layer gets its own quoting function, and
+// callers quote once per layer from the inside out.
+
+// shellSafe are the characters that never need quoting in a POSIX shell word
+const shellSafe = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_"
+
+// shellQuote returns s as a single POSIX shell word. Plain words are left alone,
+// everything else is wrapped in single quotes. An embedded ' closes the quotes,
+// is written as \' and then the quotes reopen.
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.Trim(s, shellSafe) == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellJoin quotes every argument and joins them into one command line
+func shellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// appleScriptString returns s as an AppleScript string literal, quotes included
+func appleScriptString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
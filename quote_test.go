@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+var hostileInputs = []struct {
+	name  string
+	in    string
+	shell string
+	apple string
+}{
+	{"empty", "", `''`, `""`},
+	{"plain word", "prod-db-01", `prod-db-01`, `"prod-db-01"`},
+	{"safe punctuation", "user@host:/var/log,a=b%c+d", `user@host:/var/log,a=b%c+d`, `"user@host:/var/log,a=b%c+d"`},
+	{"space", "tail -f /var/log/syslog", `'tail -f /var/log/syslog'`, `"tail -f /var/log/syslog"`},
+	{"single quote", "it's", `'it'\''s'`, `"it's"`},
+	{"only single quotes", "''", `''\'''\'''`, `"''"`},
+	{"double quote", `say "hi"`, `'say "hi"'`, `"say \"hi\""`},
+	{"backslash", `C:\temp\`, `'C:\temp\'`, `"C:\\temp\\"`},
+	{"newline", "a\nb", "'a\nb'", `"a\nb"`},
+	{"carriage return and tab", "a\r\tb", "'a\r\tb'", `"a\r\tb"`},
+	{"command substitution", "$(rm -rf ~)", `'$(rm -rf ~)'`, `"$(rm -rf ~)"`},
+	{"backticks", "`id`", "'`id`'", "\"`id`\""},
+	{"variable", "$HOME", `'$HOME'`, `"$HOME"`},
+	{"glob and separators", "*; ls | cat &", `'*; ls | cat &'`, `"*; ls | cat &"`},
+	{"mixed", `echo "it's" \ $(x)`, `'echo "it'\''s" \ $(x)'`, `"echo \"it's\" \\ $(x)"`},
+	{"unicode", "héllo wörld", `'héllo wörld'`, `"héllo wörld"`},
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, tt := range hostileInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shellQuote(tt.in); got != tt.shell {
+				t.Errorf("shellQuote(%q) = %q, want %q", tt.in, got, tt.shell)
+			}
+		})
+	}
+}
+
+// TestShellQuoteRoundTrip checks that a real shell reads every quoted word back unchanged
+func TestShellQuoteRoundTrip(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh on PATH")
+	}
+	for _, tt := range hostileInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(tt.in)).Output()
+			if err != nil {
+				t.Fatalf("sh failed for %q: %v", tt.in, err)
+			}
+			if string(out) != tt.in {
+				t.Errorf("sh read %q back as %q", tt.in, out)
+			}
+		})
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		argv []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"ssh", "prod-db-01"}, "ssh prod-db-01"},
+		{[]string{"ssh", "-t", "prod-db-01", "htop -d 5"}, "ssh -t prod-db-01 'htop -d 5'"},
+		{[]string{"sh", "-c", "echo '$(id)'", ""}, `sh -c 'echo '\''$(id)'\''' ''`},
+	}
+	for _, tt := range tests {
+		if got := shellJoin(tt.argv); got != tt.want {
+			t.Errorf("shellJoin(%q) = %q, want %q", tt.argv, got, tt.want)
+		}
+	}
+}
+
+func TestAppleScriptString(t *testing.T) {
+	for _, tt := range hostileInputs {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := appleScriptString(tt.in); got != tt.apple {
+				t.Errorf("appleScriptString(%q) = %q, want %q", tt.in, got, tt.apple)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sahilm/fuzzy"
+)
+
+// Matching hosts are ranked by how well the alias matches the positive bare
+// terms of the query, best first. Each term scores by tier and the tiers add up
+// over the terms; ties go to the most frecent host, then to config order.
+const (
+	scoreExact  = 1000 // The alias is the term
+	scorePrefix = 500  // The alias starts with the term
+	scoreWord   = 300  // The term is a whole word of the alias
+	scoreInfix  = 200  // The term appears inside the alias (TUI filter)
+	scoreFuzzy  = 100  // The term's characters appear in order in the alias (plus up to 99 for closeness)
+	scoreField  = 50   // Only the hostname, group or a tag matched
+)
+
+// RankedHost is a matching host with its score and the alias runes to highlight
+type RankedHost struct {
+	Host    SearchableHost
+	Score   int
+	Matched []int // Rune indexes into the alias
+}
+
+// Rank returns the matching hosts, best first. Queries without bare terms
+// (e.g. only "group:prod") keep the config order.
+//
+// In the TUI filter a bare term that matches no host at all falls back to fuzzy
+// matching on the alias, so "pdb" still finds "prod-db-01".
+func (q *Query) Rank(hosts []SearchableHost, frecency map[string]float64) []RankedHost {
+	terms := q.rankTerms()
+	for _, t := range terms {
+		if t.substr && !matchesAny(t, hosts) {
+			t.fuzzy = true
+		}
+	}
+
+	var ranked []RankedHost
+	for _, h := range hosts {
+		if !q.Match(h) {
+			continue
+		}
+		r := RankedHost{Host: h}
+		if len(terms) > 0 {
+			r.Score, r.Matched = scoreAlias(h, terms)
+		}
+		ranked = append(ranked, r)
+	}
+	if len(terms) == 0 {
+		return ranked
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return frecency[ranked[i].Host.Alias] > frecency[ranked[j].Host.Alias]
+	})
+	return ranked
+}
+
+// rankTerms collects the bare and alias: terms outside negations, the ones that
+// describe what the user is looking for
+func (q *Query) rankTerms() []*termNode {
+	var terms []*termNode
+	var walk func(n queryNode)
+	walk = func(n queryNode) {
+		switch n := n.(type) {
+		case andNode:
+			for _, c := range n {
+				walk(c)
+			}
+		case orNode:
+			for _, c := range n {
+				walk(c)
+			}
+		case *termNode:
+			if (n.field == "" || n.field == "alias") && n.re == nil && !n.glob && n.value != "" {
+				terms = append(terms, n)
+			}
+		}
+	}
+	walk(q.root)
+	return terms
+}
+
+// matchesAny reports whether the term matches at least one of the hosts
+func matchesAny(t *termNode, hosts []SearchableHost) bool {
+	for i := range hosts {
+		if t.match(&hosts[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// scoreAlias adds up the tiers of each term against the alias, and collects the
+// matched rune positions for highlighting
+func scoreAlias(h SearchableHost, terms []*termNode) (int, []int) {
+	// The terms are matched against the lowercased alias, byte by byte.
+	// runeAt maps those byte offsets back to runes of the alias as displayed.
+	var lower strings.Builder
+	var runeAt []int
+	for i, r := range []rune(h.Alias) {
+		l := strings.ToLower(string(r))
+		lower.WriteString(l)
+		for range len(l) {
+			runeAt = append(runeAt, i)
+		}
+	}
+	alias := lower.String()
+
+	matched := make(map[int]bool)
+	span := func(start, length int) {
+		for i := start; i < start+length; i++ {
+			matched[runeAt[i]] = true
+		}
+	}
+
+	score := 0
+	for _, t := range terms {
+		switch {
+		case alias == t.value:
+			score += scoreExact
+			span(0, len(alias))
+		case strings.HasPrefix(alias, t.value):
+			score += scorePrefix
+			span(0, len(t.value))
+		case wordIndex(alias, t.value) >= 0:
+			score += scoreWord
+			span(wordIndex(alias, t.value), len(t.value))
+		case t.phrase && strings.Contains(alias, t.value):
+			score += scoreWord
+			span(strings.Index(alias, t.value), len(t.value))
+		case t.substr && strings.Contains(alias, t.value):
+			score += scoreInfix
+			span(strings.Index(alias, t.value), len(t.value))
+		default:
+			if m := fuzzy.Find(t.value, []string{alias}); len(m) > 0 {
+				score += scoreFuzzy + min(max(m[0].Score, 0), 99)
+				for _, i := range m[0].MatchedIndexes {
+					matched[runeAt[i]] = true
+				}
+			} else if t.match(&h) {
+				score += scoreField
+			}
+		}
+	}
+
+	var indexes []int
+	for i := range matched {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return score, indexes
+}
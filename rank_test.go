@@ -0,0 +1,110 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func rankAliases(ranked []RankedHost) []string {
+	var aliases []string
+	for _, r := range ranked {
+		aliases = append(aliases, r.Host.Alias)
+	}
+	return aliases
+}
+
+func TestRank(t *testing.T) {
+	tests := []struct {
+		query  string
+		filter bool // Parsed like the TUI filter
+		want   []string
+	}{
+		{"db", false, []string{"prod-db-01", "dev-db-01"}},
+		{"prod-db", false, []string{"prod-db-01", "prod-dbproxy"}},
+		{"prod-dbproxy", false, []string{"prod-dbproxy"}},
+		{"group:prod", false, []string{"prod-east-01", "prod-db-01", "prod-dbproxy"}},
+
+		// Exact before prefix before words before the other fields
+		{"prod-db-01 OR prod OR web", false, []string{"prod-db-01", "prod-east-01", "prod-dbproxy", "staging-web-01"}},
+
+		// The TUI filter adds substrings, and fuzzy matches when nothing else hits
+		{"eas", true, []string{"prod-east-01"}},
+		{"b-0", true, []string{"prod-db-01", "staging-web-01", "dev-db-01"}},
+		{"pdb", true, []string{"prod-db-01", "prod-dbproxy"}},
+		{"pdb01", true, []string{"prod-db-01"}},
+		{"sw01", true, []string{"staging-web-01"}},
+		{"pdb group:dev", true, nil},
+		{"pdb", false, nil},
+		{"zzz", true, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			parse := ParseQuery
+			if tt.filter {
+				parse = ParseFilterQuery
+			}
+			q, err := parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rankAliases(q.Rank(queryTestHosts, nil)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rank(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankFrecencyBreaksTies(t *testing.T) {
+	q, err := ParseQuery("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rankAliases(q.Rank(queryTestHosts, map[string]float64{"dev-db-01": 3, "prod-db-01": 1}))
+	want := []string{"dev-db-01", "prod-db-01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank = %q, want %q", got, want)
+	}
+}
+
+// TestRankMatchedRunes checks that highlights are rune indexes into the alias,
+// also when it has multi-byte characters
+func TestRankMatchedRunes(t *testing.T) {
+	hosts := []SearchableHost{
+		{Alias: "prod-db-01"},
+		{Alias: "café-db"},
+		{Alias: "ÅRHUS-web"},
+	}
+	tests := []struct {
+		query string
+		alias string
+		want  []int
+	}{
+		{"prod", "prod-db-01", []int{0, 1, 2, 3}},
+		{"db", "prod-db-01", []int{5, 6}},
+		{"pdb", "prod-db-01", []int{0, 5, 6}},
+		{"db", "café-db", []int{5, 6}},
+		{"é-d", "café-db", []int{3, 4, 5}},
+		{"cfd", "café-db", []int{0, 2, 5}},
+		{"web", "ÅRHUS-web", []int{6, 7, 8}},
+		{"århus", "ÅRHUS-web", []int{0, 1, 2, 3, 4}},
+		{"rhw", "ÅRHUS-web", []int{1, 2, 6}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := ParseFilterQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, r := range q.Rank(hosts, nil) {
+				if r.Host.Alias == tt.alias {
+					if !reflect.DeepEqual(r.Matched, tt.want) {
+						t.Errorf("Rank(%q) highlights %v of %s, want %v", tt.query, r.Matched, tt.alias, tt.want)
+					}
+					return
+				}
+			}
+			t.Errorf("Rank(%q) did not match %s", tt.query, tt.alias)
+		})
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"os/exec"
 )
 
 // RunScript streams a local script to a remote host and executes it in memory
@@ -15,41 +14,48 @@ func RunScript(scriptPath, hostAlias string, cfg *Config) error {
 
 	fmt.Printf("🚀 Streaming %s to %s...\n", scriptPath, hostAlias)
 
-	// 2. Set up the SSH command
+	// 2. Set up the SSH command (the builder injects the correct SSH Agent Socket!)
 	// 'bash -s' tells the remote bash session to read commands from standard input
-	sshArgs := []string{
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "UserKnownHostsFile=/dev/null",
-		hostAlias,
-		"bash -s", 
-	}
-	cmd := exec.Command("ssh", sshArgs...)
-
-	// 3. Inject the correct SSH Agent Socket!
-	sockPath := getSocketForHost(hostAlias, cfg)
-	if sockPath != "" {
-		cmd.Env = os.Environ()
-		cmd.Env = append(cmd.Env, fmt.Sprintf("SSH_AUTH_SOCK=%s", sockPath))
-	}
+	cmd := NewSSH(cfg.LookupHost(hostAlias), cfg, "bash -s").Cmd()
 
-	// 4. Open the local script file
+	// 3. Open the local script file
 	file, err := os.Open(scriptPath)
 	if err != nil {
 		return fmt.Errorf("failed to open script: %v", err)
 	}
 	defer file.Close()
 
-	// 5. Wire up the inputs and outputs
+	// 4. Wire up the inputs and outputs
 	// Stdin gets the file content. Stdout/Stderr go straight to your Mac's terminal.
 	cmd.Stdin = file
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	// 6. Execute!
-	if err := cmd.Run(); err != nil {
+	// 5. Execute!
+	if err := runCommand(cmd); err != nil {
 		return fmt.Errorf("script execution failed: %v", err)
 	}
 
 	fmt.Println("✅ Execution complete!")
 	return nil
 }
+
+// RunMacro runs a macro's command on a remote host, streaming its output here.
+// 'wssh macro' types macros into the active pane instead; this is for running
+// one on several hosts picked in the TUI.
+func RunMacro(macroName, hostAlias string, cfg *Config) error {
+	command, exists := cfg.Macros[macroName]
+	if !exists {
+		return fmt.Errorf("macro '%s' not found under 'macros'", macroName)
+	}
+
+	fmt.Printf("🚀 Running macro '%s' on %s...\n", macroName, hostAlias)
+
+	cmd := NewSSH(cfg.LookupHost(hostAlias), cfg, command).Cmd()
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := runCommand(cmd); err != nil {
+		return fmt.Errorf("macro failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// launchPane is one fully resolved pane of a layout: the host it targets and the
+// command line that gets typed into it.
+type launchPane struct {
+	Host    SearchableHost
+	Command string
+}
+
+// LaunchLayout handles layouts, applies profiles, and wraps the command in logging/flags
+func LaunchLayout(host SearchableHost, layout string, cfg *Config) error {
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	if err := launchLayout(backend, host, layout, cfg); err != nil {
+		return err
+	}
+	return backend.Attach()
+}
+
+// LaunchEach opens every host in its own tab with the same layout. A host that
+// fails is reported and the others still open.
+func LaunchEach(hosts []SearchableHost, layout string, cfg *Config) error {
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if err := launchLayout(backend, h, layout, cfg); err != nil {
+			fmt.Printf("❌ Failed to launch session for %s: %v\n", h.Alias, err)
+		}
+	}
+	return backend.Attach()
+}
+
+// launchLayout opens one tab for the host in the layout
+func launchLayout(backend Backend, host SearchableHost, layout string, cfg *Config) error {
+	// 1. Resolve the layout definition
+	def, err := ResolveLayout(layout, cfg)
+	if err != nil {
+		return err
+	}
+
+	// 2. Work out what every pane runs (pane overrides may point at other hosts)
+	panes := planPanes([]SearchableHost{host}, def, cfg)
+
+	if err := launchPanes(backend, def, panes); err != nil {
+		return err
+	}
+
+	// 3. Remember it, the TUI layout picker starts from the last one
+	if err := RememberLayout(host.Alias, layout); err != nil {
+		fmt.Printf("Warning: Failed to remember the layout: %v\n", err)
+	}
+	return nil
+}
+
+// LaunchTiled packs many hosts into as few tabs as possible, one host per pane.
+// layout is either a named layout (each tab holds that many hosts) or "auto",
+// which picks a near-square grid of up to settings.tile_max_panes panes per tab.
+func LaunchTiled(hosts []SearchableHost, layout string, cfg *Config) error {
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+
+	perTab := 0
+	if layout != "auto" {
+		def, err := ResolveLayout(layout, cfg)
+		if err != nil {
+			return err
+		}
+		perTab = def.PaneCount()
+	} else {
+		perTab = cfg.Settings.TileMaxPanes
+		if perTab <= 0 {
+			perTab = defaultTileMaxPanes
+		}
+	}
+
+	for start := 0; start < len(hosts); start += perTab {
+		end := start + perTab
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		chunk := hosts[start:end]
+
+		// A partially filled tab (or auto mode) gets a grid sized to the hosts left
+		var def Layout
+		if layout == "auto" || len(chunk) < perTab {
+			def, err = AutoGridLayout(len(chunk))
+		} else {
+			def, err = ResolveLayout(layout, cfg)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := launchPanes(backend, def, planPanes(chunk, def, cfg)); err != nil {
+			return err
+		}
+	}
+	return backend.Attach()
+}
+
+// LaunchOneTab tiles every host into a single tab, however many there are
+func LaunchOneTab(hosts []SearchableHost, cfg *Config) error {
+	if len(hosts) == 0 {
+		return fmt.Errorf("no hosts to tile")
+	}
+	def, err := AutoGridLayout(len(hosts))
+	if err != nil {
+		return err
+	}
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	if err := launchPanes(backend, def, planPanes(hosts, def, cfg)); err != nil {
+		return err
+	}
+	return backend.Attach()
+}
+
+// ConnectHosts opens every host in its own tab, or tiles them into panes
+// of as few tabs as possible when tileLayout is set.
+func ConnectHosts(hosts []SearchableHost, tileLayout string, cfg *Config) {
+	if tileLayout != "" {
+		if err := LaunchTiled(hosts, tileLayout, cfg); err != nil {
+			fmt.Printf("❌ Failed to tile sessions: %v\n", err)
+		}
+		return
+	}
+
+	if err := LaunchEach(hosts, "single", cfg); err != nil {
+		fmt.Printf("❌ Failed to launch sessions: %v\n", err)
+	}
+}
+
+// launchPanes builds the resolved panes as a new tab of the backend
+func launchPanes(backend Backend, def Layout, panes []launchPane) error {
+	// 1. Generate the split sequence from the layout rows
+	if err := applyLayout(backend, def, panes); err != nil {
+		return err
+	}
+
+	// 2. Log every distinct host to your local history file
+	logged := make(map[string]bool)
+	for _, p := range panes {
+		if logged[p.Host.Alias] {
+			continue
+		}
+		logged[p.Host.Alias] = true
+		if err := LogConnection(p.Host.Alias); err != nil {
+			fmt.Printf("Warning: Failed to log connection history: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// planPanes resolves the per-pane host and command overrides of a layout.
+// With a single host every pane defaults to it and `host` overrides apply.
+// When tiling several hosts pane i runs hosts[i] and only the command template is used.
+func planPanes(hosts []SearchableHost, l Layout, cfg *Config) []launchPane {
+	tiling := len(hosts) > 1
+
+	var panes []launchPane
+	for _, row := range l.Rows {
+		for c := 0; c < row.Panes; c++ {
+			var override PaneCommand
+			if c < len(row.Commands) {
+				override = row.Commands[c]
+			}
+
+			paneHost := hosts[0]
+			if tiling {
+				paneHost = hosts[len(panes)]
+			} else if override.Host != "" {
+				paneHost = cfg.LookupHost(override.Host)
+			}
+
+			remoteCmd := expandPaneTemplate(override.Command, paneHost)
+			panes = append(panes, launchPane{
+				Host:    paneHost,
+				Command: getCmdForPane(paneHost, remoteCmd, len(panes)+1, cfg),
+			})
+		}
+	}
+	return panes
+}
+
+// expandPaneTemplate fills in the {alias}, {hostname} and {group} placeholders
+func expandPaneTemplate(tmpl string, host SearchableHost) string {
+	hostname := host.Hostname
+	if hostname == "" {
+		hostname = host.Alias
+	}
+	return strings.NewReplacer(
+		"{alias}", host.Alias,
+		"{hostname}", hostname,
+		"{group}", host.GroupName,
+	).Replace(tmpl)
+}
+
+// getCmdForPane builds the shell command line for a pane, optionally running
+// remoteCmd on the host and wrapping the whole thing in session logging.
+// Every argument is shell-quoted, so the result is safe to hand to sh -c.
+func getCmdForPane(host SearchableHost, remoteCmd string, paneIndex int, cfg *Config) string {
+	// 1. Build the ssh call (env SSH_AUTH_SOCK=... ssh [options] alias [remoteCmd]).
+	// ssh hands the remote command to the remote shell as-is, so it stays one word here.
+	sshCmd := NewSSH(host, cfg, remoteCmd)
+	if remoteCmd != "" {
+		// Interactive remote commands (htop, journalctl -f) need a TTY
+		sshCmd.WithTTY()
+	}
+	sshArgv := sshCmd.ShellArgv()
+
+	if !host.LogSession {
+		return shellJoin(sshArgv)
+	}
+
+	logDir := sessionLogDir()
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+
+	logFile := filepath.Join(logDir, fmt.Sprintf("%s_%s_pane%d.log", host.Alias, timestamp, paneIndex))
+	if dryRun != nil {
+		dryRun.record(PlanStep{Kind: "log_file", LogFile: logFile, Note: fmt.Sprintf("session log for %s pane %d", host.Alias, paneIndex)})
+	} else {
+		os.MkdirAll(logDir, 0755)
+	}
+
+	// 2. Wrap the SSH command in the 'script' utility (BSD and util-linux disagree on syntax)
+	if runtime.GOOS == "darwin" {
+		return shellJoin(append([]string{"script", "-q", logFile}, sshArgv...))
+	}
+	return shellJoin([]string{"script", "-q", "-c", shellJoin(sshArgv), logFile})
+}
+
+// sessionLogDir is where session logs go, one file per pane named
+// <alias>_<timestamp>_pane<n>.log
+func sessionLogDir() string {
+	homeDir, _ := os.UserHomeDir()
+	return filepath.Join(homeDir, "wssh_logs")
+}
+
+// sessionLogName matches the part of a session log name after "<alias>_"
+var sessionLogName = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2}_pane\d+\.log$`)
+
+// RecentSessionLogs returns the paths of the host's session logs, newest first, up to limit
+func RecentSessionLogs(alias string, limit int) []string {
+	entries, err := os.ReadDir(sessionLogDir())
+	if err != nil {
+		return nil // No logs yet
+	}
+
+	var logs []string
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), alias+"_")
+		if ok && !e.IsDir() && sessionLogName.MatchString(rest) {
+			logs = append(logs, filepath.Join(sessionLogDir(), e.Name()))
+		}
+	}
+
+	// The timestamps sort by name
+	sort.Sort(sort.Reverse(sort.StringSlice(logs)))
+	return logs[:min(len(logs), limit)]
+}
+
+// useInline reports whether single sessions should replace wssh in the current terminal
+func useInline(flag bool, cfg *Config) bool {
+	return flag || cfg.Settings.ConnectMode == "inline"
+}
+
+// ExecInline replaces the wssh process with the host's ssh session in the current TTY.
+// The command line is the same one a single pane would run, so options and session
+// logging behave identically. It only returns if the exec itself fails (or in dry-run mode).
+func ExecInline(host SearchableHost, cfg *Config) error {
+	cmdLine := getCmdForPane(host, "", 1, cfg)
+	env := os.Environ()
+
+	if err := LogConnection(host.Alias); err != nil {
+		fmt.Printf("Warning: Failed to log connection history: %v\n", err)
+	}
+	if err := RememberLayout(host.Alias, "single"); err != nil {
+		fmt.Printf("Warning: Failed to remember the layout: %v\n", err)
+	}
+
+	// 'exec' makes the shell replace itself too, leaving ssh (or script) as the process
+	argv := []string{"sh", "-c", "exec " + cmdLine}
+	if dryRun != nil {
+		dryRun.record(PlanStep{Kind: "exec", Argv: argv, Note: "replaces the wssh process"})
+		return nil
+	}
+	return syscall.Exec("/bin/sh", argv, env)
+}
+
+// SendMacro injects text into the currently active pane and executes it
+func SendMacro(command string, cfg *Config) error {
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return err
+	}
+	return backend.SendText(command)
+}
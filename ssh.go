@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// SSHCommand is an ssh or scp invocation with every setting from the config
+// applied: global host key handling, the host's connection settings and the
+// agent socket of its environment. All subcommands build their ssh/scp calls
+// through NewSSH/NewSCP so they behave the same way.
+type SSHCommand struct {
+	Program   string   // "ssh" or "scp"
+	Options   []string // Flags placed before the destination
+	Target    string   // ssh destination (empty for scp, where the host is part of Args)
+	Args      []string // Remote command for ssh, source and destination for scp
+	AgentSock string   // SSH_AUTH_SOCK for the child, empty to inherit ours
+}
+
+// NewSSH builds `ssh [options] alias [remoteCmd]` for the host. The alias stays
+// the destination so ~/.ssh/config entries for it still apply, while the
+// inventory hostname is passed as -o HostName (see sshOptions).
+func NewSSH(host SearchableHost, cfg *Config, remoteCmd string) *SSHCommand {
+	c := &SSHCommand{
+		Program:   "ssh",
+		Options:   sshOptions(host, cfg),
+		Target:    host.Alias,
+		AgentSock: agentSockFor(host, cfg),
+	}
+	if remoteCmd != "" {
+		c.Args = []string{remoteCmd}
+	}
+	return c
+}
+
+// NewSCP builds `scp [options] localPath alias:remotePath` for the host
+func NewSCP(host SearchableHost, cfg *Config, localPath, remotePath string) *SSHCommand {
+	return &SSHCommand{
+		Program:   "scp",
+		Options:   sshOptions(host, cfg),
+		Args:      []string{localPath, fmt.Sprintf("%s:%s", host.Alias, remotePath)},
+		AgentSock: agentSockFor(host, cfg),
+	}
+}
+
+// WithTTY forces a TTY, needed for interactive remote commands like htop
+func (c *SSHCommand) WithTTY() *SSHCommand {
+	c.Options = append([]string{"-t"}, c.Options...)
+	return c
+}
+
+// Argv returns the full argument vector, program first
+func (c *SSHCommand) Argv() []string {
+	argv := append([]string{c.Program}, c.Options...)
+	if c.Target != "" {
+		argv = append(argv, c.Target)
+	}
+	return append(argv, c.Args...)
+}
+
+// Env returns the environment overrides the command needs
+func (c *SSHCommand) Env() []string {
+	if c.AgentSock == "" {
+		return nil
+	}
+	return []string{"SSH_AUTH_SOCK=" + c.AgentSock}
+}
+
+// Cmd returns an exec.Cmd with the environment overrides applied
+func (c *SSHCommand) Cmd() *exec.Cmd {
+	argv := c.Argv()
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if env := c.Env(); env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	return cmd
+}
+
+// ShellArgv prefixes the argv with `env VAR=value` so the overrides survive
+// being typed into a terminal pane
+func (c *SSHCommand) ShellArgv() []string {
+	if env := c.Env(); env != nil {
+		return append(append([]string{"env"}, env...), c.Argv()...)
+	}
+	return c.Argv()
+}
+
+// ShellLine is ShellArgv as a quoted command line
+func (c *SSHCommand) ShellLine() string {
+	return shellJoin(c.ShellArgv())
+}
+
+// agentSockFor resolves the host's agent socket to an absolute path
+func agentSockFor(host SearchableHost, cfg *Config) string {
+	sockPath := getSocketForHost(host, cfg)
+	if sockPath == "" {
+		return ""
+	}
+	return expandPath(sockPath)
+}
+
+// sshOptions returns the flags shared by ssh and scp: the host's connection
+// settings, then the global host key handling. ssh and scp spell port/user flags
+// differently, but both accept the same -o Key=Value pairs. ssh keeps the first
+// value it gets for an option, so the host's ssh_options come before the globals.
+func sshOptions(host SearchableHost, cfg *Config) []string {
+	var args []string
+
+	// 1. Connect to the inventory hostname, the same address resolveJump uses
+	// when the host is a jump hop
+	if host.Hostname != "" && host.Hostname != host.Alias {
+		args = append(args, "-o", "HostName="+host.Hostname)
+	}
+
+	// 2. Per-host user, port, identity, jump and extra options from the inventory
+	s := host.SSH
+	if s.User != "" {
+		args = append(args, "-o", "User="+s.User)
+	}
+	if s.Port != 0 {
+		args = append(args, "-o", fmt.Sprintf("Port=%d", s.Port))
+	}
+	if s.IdentityFile != "" {
+		args = append(args, "-o", "IdentityFile="+expandPath(s.IdentityFile))
+	}
+	if s.Jump != "" {
+		args = append(args, "-o", "ProxyJump="+resolveJump(s.Jump, cfg))
+	}
+
+	// Sort the free-form options so the generated command is stable between runs
+	var keys []string
+	for k := range s.SSHOptions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		args = append(args, "-o", fmt.Sprintf("%s=%s", k, s.SSHOptions[k]))
+	}
+
+	// 3. Ignore Key Changes (Default is true if missing from YAML), unless the
+	// host sets its own host key options
+	ignoreKeys := true
+	if cfg.Settings.IgnoreKeyChanges != nil {
+		ignoreKeys = *cfg.Settings.IgnoreKeyChanges
+	}
+	if ignoreKeys {
+		for _, opt := range []string{"StrictHostKeyChecking=no", "UserKnownHostsFile=/dev/null"} {
+			key, _, _ := strings.Cut(opt, "=")
+			if !hasSSHOption(s.SSHOptions, key) {
+				args = append(args, "-o", opt)
+			}
+		}
+	}
+
+	return args
+}
+
+// hasSSHOption reports whether options sets key. ssh option names are case-insensitive.
+func hasSSHOption(options map[string]string, key string) bool {
+	for k := range options {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveJump expands inventory aliases in a ProxyJump list into user@hostname:port,
+// so jump hosts don't also need an entry in ~/.ssh/config
+func resolveJump(jump string, cfg *Config) string {
+	var hops []string
+	for _, hop := range strings.Split(jump, ",") {
+		hop = strings.TrimSpace(hop)
+		h := cfg.LookupHost(hop)
+		if h.Hostname == "" {
+			hops = append(hops, hop) // Not in the inventory, let ssh resolve it
+			continue
+		}
+
+		target := h.Hostname
+		if h.SSH.User != "" {
+			target = h.SSH.User + "@" + target
+		}
+		if h.SSH.Port != 0 {
+			target = fmt.Sprintf("%s:%d", target, h.SSH.Port)
+		}
+		hops = append(hops, target)
+	}
+	return strings.Join(hops, ",")
+}
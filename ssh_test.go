@@ -0,0 +1,317 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testSSHConfig is a small inventory with a jump host, per-host settings and an agent env
+func testSSHConfig(ignoreKeys *bool) *Config {
+	return &Config{
+		Settings: Settings{
+			IgnoreKeyChanges: ignoreKeys,
+			SSHAgentEnvs: map[string]AgentEnv{
+				"prod": {Sock: "~/.ssh/prod.sock", Key: "~/.ssh/prod_key"},
+			},
+		},
+		Groups: []Group{
+			{
+				Name:        "infra",
+				SSHSettings: SSHSettings{User: "ops"},
+				Hosts: []Host{
+					{Alias: "bastion", Hostname: "bastion.example.com", SSHSettings: SSHSettings{Port: 2222}},
+					{Alias: "bastion2", Hostname: "10.0.0.2"},
+				},
+			},
+			{
+				Name:        "prod",
+				SSHSettings: SSHSettings{Jump: "bastion", SSHOptions: map[string]string{"ServerAliveInterval": "30", "Compression": "yes"}},
+				Hosts: []Host{
+					{Alias: "prod-db-01", Hostname: "10.1.0.1", SSHSettings: SSHSettings{User: "postgres", Port: 5433}},
+					{Alias: "prod-web-01", Hostname: "10.1.0.2", SSHSettings: SSHSettings{Jump: "bastion, bastion2 ,outside.example.com", IdentityFile: "~/.ssh/web"}},
+					{Alias: "prod-plain", Hostname: "prod-plain"},
+					{Alias: "prod-strict", Hostname: "10.1.0.3", SSHSettings: SSHSettings{SSHOptions: map[string]string{"stricthostkeychecking": "yes"}}},
+				},
+			},
+		},
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestSSHOptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	tests := []struct {
+		name       string
+		ignoreKeys *bool
+		alias      string
+		want       []string
+	}{
+		{
+			name:  "ignore_key_changes defaults to on",
+			alias: "bastion2",
+			want: []string{
+				"-o", "HostName=10.0.0.2", "-o", "User=ops",
+				"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null",
+			},
+		},
+		{
+			name:       "ignore_key_changes off",
+			ignoreKeys: boolPtr(false),
+			alias:      "bastion2",
+			want:       []string{"-o", "HostName=10.0.0.2", "-o", "User=ops"},
+		},
+		{
+			name:       "host user and port override the group, jump alias is resolved",
+			ignoreKeys: boolPtr(false),
+			alias:      "prod-db-01",
+			want: []string{
+				"-o", "HostName=10.1.0.1", "-o", "User=postgres", "-o", "Port=5433",
+				"-o", "ProxyJump=ops@bastion.example.com:2222",
+				"-o", "Compression=yes", "-o", "ServerAliveInterval=30",
+			},
+		},
+		{
+			name:       "identity file and a jump chain with a host outside the inventory",
+			ignoreKeys: boolPtr(false),
+			alias:      "prod-web-01",
+			want: []string{
+				"-o", "HostName=10.1.0.2", "-o", "IdentityFile=" + filepath.Join(home, ".ssh/web"),
+				"-o", "ProxyJump=ops@bastion.example.com:2222,ops@10.0.0.2,outside.example.com",
+				"-o", "Compression=yes", "-o", "ServerAliveInterval=30",
+			},
+		},
+		{
+			name:       "hostname equal to the alias is not repeated",
+			ignoreKeys: boolPtr(false),
+			alias:      "prod-plain",
+			want: []string{
+				"-o", "ProxyJump=ops@bastion.example.com:2222",
+				"-o", "Compression=yes", "-o", "ServerAliveInterval=30",
+			},
+		},
+		{
+			name:  "host key options of the host come first and replace the global ones",
+			alias: "prod-strict",
+			want: []string{
+				"-o", "HostName=10.1.0.3", "-o", "ProxyJump=ops@bastion.example.com:2222",
+				"-o", "Compression=yes", "-o", "ServerAliveInterval=30", "-o", "stricthostkeychecking=yes",
+				"-o", "UserKnownHostsFile=/dev/null",
+			},
+		},
+		{
+			name:       "unknown alias gets no host settings",
+			ignoreKeys: boolPtr(false),
+			alias:      "not-in-inventory",
+			want:       nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testSSHConfig(tt.ignoreKeys)
+			got := sshOptions(cfg.LookupHost(tt.alias), cfg)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sshOptions(%s)\n got  %q\n want %q", tt.alias, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveJump(t *testing.T) {
+	cfg := testSSHConfig(nil)
+	tests := []struct {
+		jump string
+		want string
+	}{
+		{"bastion", "ops@bastion.example.com:2222"},
+		{"bastion2", "ops@10.0.0.2"},
+		{"bastion,bastion2", "ops@bastion.example.com:2222,ops@10.0.0.2"},
+		{" bastion2 , jump.example.com:22 ", "ops@10.0.0.2,jump.example.com:22"},
+		{"root@elsewhere", "root@elsewhere"},
+	}
+	for _, tt := range tests {
+		if got := resolveJump(tt.jump, cfg); got != tt.want {
+			t.Errorf("resolveJump(%q) = %q, want %q", tt.jump, got, tt.want)
+		}
+	}
+}
+
+func TestNewSSH(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := testSSHConfig(boolPtr(false))
+	sock := "SSH_AUTH_SOCK=" + filepath.Join(home, ".ssh/prod.sock")
+
+	tests := []struct {
+		name      string
+		alias     string
+		remoteCmd string
+		tty       bool
+		argv      []string
+		env       []string
+	}{
+		{
+			name:  "interactive session targets the alias with the agent of its env",
+			alias: "prod-db-01",
+			argv: []string{"ssh",
+				"-o", "HostName=10.1.0.1", "-o", "User=postgres", "-o", "Port=5433",
+				"-o", "ProxyJump=ops@bastion.example.com:2222",
+				"-o", "Compression=yes", "-o", "ServerAliveInterval=30",
+				"prod-db-01"},
+			env: []string{sock},
+		},
+		{
+			name:      "remote command with a TTY",
+			alias:     "bastion2",
+			remoteCmd: "htop -d 5",
+			tty:       true,
+			argv:      []string{"ssh", "-t", "-o", "HostName=10.0.0.2", "-o", "User=ops", "bastion2", "htop -d 5"},
+		},
+		{
+			name:  "no matching agent env inherits SSH_AUTH_SOCK",
+			alias: "ad-hoc",
+			argv:  []string{"ssh", "ad-hoc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewSSH(cfg.LookupHost(tt.alias), cfg, tt.remoteCmd)
+			if tt.tty {
+				c.WithTTY()
+			}
+			if got := c.Argv(); !reflect.DeepEqual(got, tt.argv) {
+				t.Errorf("Argv()\n got  %q\n want %q", got, tt.argv)
+			}
+			if got := c.Env(); !reflect.DeepEqual(got, tt.env) {
+				t.Errorf("Env() = %q, want %q", got, tt.env)
+			}
+
+			wantShell := tt.argv
+			if tt.env != nil {
+				wantShell = append(append([]string{"env"}, tt.env...), tt.argv...)
+			}
+			if got := c.ShellArgv(); !reflect.DeepEqual(got, wantShell) {
+				t.Errorf("ShellArgv()\n got  %q\n want %q", got, wantShell)
+			}
+
+			cmd := c.Cmd()
+			if !reflect.DeepEqual(cmd.Args, tt.argv) {
+				t.Errorf("Cmd().Args = %q, want %q", cmd.Args, tt.argv)
+			}
+			if got := envOverrides(cmd.Env); !reflect.DeepEqual(got, tt.env) {
+				t.Errorf("Cmd() env overrides = %q, want %q", got, tt.env)
+			}
+		})
+	}
+}
+
+func TestNewSCP(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := testSSHConfig(nil)
+
+	c := NewSCP(cfg.LookupHost("prod-db-01"), cfg, "/tmp/app.tar", "/opt/app.tar")
+	want := []string{"scp",
+		"-o", "HostName=10.1.0.1", "-o", "User=postgres", "-o", "Port=5433",
+		"-o", "ProxyJump=ops@bastion.example.com:2222",
+		"-o", "Compression=yes", "-o", "ServerAliveInterval=30",
+		"-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null",
+		"/tmp/app.tar", "prod-db-01:/opt/app.tar"}
+	if got := c.Argv(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Argv()\n got  %q\n want %q", got, want)
+	}
+	wantEnv := []string{"SSH_AUTH_SOCK=" + filepath.Join(home, ".ssh/prod.sock")}
+	if got := c.Env(); !reflect.DeepEqual(got, wantEnv) {
+		t.Errorf("Env() = %q, want %q", got, wantEnv)
+	}
+}
+
+// recordPlan runs fn in dry-run mode and returns the steps it recorded
+func recordPlan(t *testing.T, fn func() error) []PlanStep {
+	t.Helper()
+	dryRun = &Plan{jsonOut: io.Discard}
+	defer func() { dryRun = nil }()
+
+	stdout := os.Stdout
+	os.Stdout, _ = os.Open(os.DevNull)
+	defer func() { os.Stdout = stdout }()
+
+	if err := fn(); err != nil {
+		t.Fatal(err)
+	}
+	return dryRun.Steps
+}
+
+// TestSubcommandsShareSSHOptions checks that run and capture build their ssh
+// calls with the same options and agent as an interactive session
+func TestSubcommandsShareSSHOptions(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	cfg := testSSHConfig(nil)
+
+	script := filepath.Join(t.TempDir(), "check.sh")
+	if err := os.WriteFile(script, []byte("uptime\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	host := cfg.LookupHost("prod-db-01")
+	options := sshOptions(host, cfg)
+	sock := "SSH_AUTH_SOCK=" + filepath.Join(home, ".ssh/prod.sock")
+
+	t.Run("run", func(t *testing.T) {
+		steps := recordPlan(t, func() error { return RunScript(script, "prod-db-01", cfg) })
+		if len(steps) != 1 {
+			t.Fatalf("got %d steps, want 1: %+v", len(steps), steps)
+		}
+		want := append(append([]string{"ssh"}, options...), "prod-db-01", "bash -s")
+		if !reflect.DeepEqual(steps[0].Argv, want) {
+			t.Errorf("argv\n got  %q\n want %q", steps[0].Argv, want)
+		}
+		if !reflect.DeepEqual(steps[0].Env, []string{sock}) {
+			t.Errorf("env = %q, want %q", steps[0].Env, []string{sock})
+		}
+	})
+
+	t.Run("capture", func(t *testing.T) {
+		steps := recordPlan(t, func() error { return RunCapture([]string{"prod-db-01"}, "port 5432", "", cfg) })
+
+		var sshSteps []PlanStep
+		for _, s := range steps {
+			if len(s.Argv) > 0 && s.Argv[0] == "ssh" {
+				sshSteps = append(sshSteps, s)
+			}
+		}
+		if len(sshSteps) != 1 {
+			t.Fatalf("got %d ssh steps, want 1: %+v", len(sshSteps), steps)
+		}
+		want := append(append([]string{"ssh"}, options...), "prod-db-01", "sudo tcpdump -U -w - port 5432")
+		if !reflect.DeepEqual(sshSteps[0].Argv, want) {
+			t.Errorf("argv\n got  %q\n want %q", sshSteps[0].Argv, want)
+		}
+		if !reflect.DeepEqual(sshSteps[0].Env, []string{sock}) {
+			t.Errorf("env = %q, want %q", sshSteps[0].Env, []string{sock})
+		}
+	})
+
+	t.Run("capture through a jumpbox socket", func(t *testing.T) {
+		steps := recordPlan(t, func() error {
+			return RunCapture([]string{"node-7.internal"}, "", "/tmp/jump.sock", cfg)
+		})
+		for _, s := range steps {
+			if len(s.Argv) > 0 && s.Argv[0] == "ssh" {
+				if !reflect.DeepEqual(s.Env, []string{"SSH_AUTH_SOCK=/tmp/jump.sock"}) {
+					t.Errorf("env = %q, want the jumpbox socket", s.Env)
+				}
+				return
+			}
+		}
+		t.Fatalf("no ssh step recorded: %+v", steps)
+	})
+}
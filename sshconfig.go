@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SSHConfigHost is one concrete Host entry read from an ssh_config file
+type SSHConfigHost struct {
+	Alias        string
+	HostName     string
+	User         string
+	Port         int
+	IdentityFile string
+	ProxyJump    string
+	Group        string // From a "# group: <name>" marker above the block
+	File         string // Where the Host line is
+	Line         int
+	Managed      bool // Only defined in the region wssh generates (see sshsync.go)
+}
+
+// maxIncludeDepth matches ssh's own limit on nested Include directives
+const maxIncludeDepth = 16
+
+// groupMarker is a comment that puts the Host blocks after it in a group,
+// until the next marker. "# group:" on its own goes back to naming patterns.
+var groupMarker = regexp.MustCompile(`^#\s*(?:wssh\s+)?group:\s*(.*)$`)
+
+// sshConfigParser follows Include directives and collects hosts and warnings
+type sshConfigParser struct {
+	hosts    []SSHConfigHost
+	index    map[string]int // Alias to position in hosts
+	warnings []string
+	visiting map[string]bool
+}
+
+// ParseSSHConfig reads the concrete hosts from an ssh_config file and the files
+// it includes. A "Host a b" line yields one entry per alias; wildcard patterns
+// describe many hosts and are skipped, as are Match blocks (with a warning).
+// An alias that appears in several blocks is returned once: like ssh, the
+// first value seen for each keyword wins.
+func ParseSSHConfig(path string) ([]SSHConfigHost, []string, error) {
+	p := &sshConfigParser{index: make(map[string]int), visiting: make(map[string]bool)}
+	if err := p.parseFile(path, 0); err != nil {
+		return nil, nil, err
+	}
+	return p.hosts, p.warnings, nil
+}
+
+func (p *sshConfigParser) parseFile(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("%s: Include nested too deeply", path)
+	}
+	if p.visiting[path] {
+		p.warnings = append(p.warnings, fmt.Sprintf("%s: skipped, it includes itself", path))
+		return nil
+	}
+	p.visiting[path] = true
+	defer delete(p.visiting, path)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var current []int // Indexes into hosts for the block we're in
+	group := ""
+	lineNo := 0
+
+	// The wssh block, or the whole file wssh generates in include mode
+	managedFile := filepath.Join(filepath.Dir(sshConfigPath()), managedIncludeFile)
+	managed := path == managedFile
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, managedBegin) {
+			managed = true
+			continue
+		}
+		if line == managedEnd {
+			managed = path == managedFile
+			continue
+		}
+		if m := groupMarker.FindStringSubmatch(line); m != nil {
+			group = strings.TrimSpace(m[1])
+			continue
+		}
+
+		key, value := splitSSHConfigLine(line)
+		if key == "" {
+			continue
+		}
+
+		switch key {
+		case "host":
+			current = nil
+			for _, pattern := range strings.Fields(value) {
+				if strings.ContainsAny(pattern, "*?!") {
+					continue
+				}
+				i, exists := p.index[pattern]
+				if !exists {
+					p.hosts = append(p.hosts, SSHConfigHost{Alias: pattern, Group: group, File: path, Line: lineNo, Managed: managed})
+					i = len(p.hosts) - 1
+					p.index[pattern] = i
+				} else if h := &p.hosts[i]; h.Managed && !managed {
+					// Also defined by the user, point at that definition
+					h.Managed, h.File, h.Line = false, path, lineNo
+				}
+				current = append(current, i)
+			}
+			continue
+		case "match":
+			current = nil
+			p.warnings = append(p.warnings, fmt.Sprintf("%s:%d: skipped Match block (%s)", path, lineNo, value))
+			continue
+		case "include":
+			for _, pattern := range strings.Fields(value) {
+				if err := p.include(pattern, depth); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// ssh uses the first value it sees for a keyword, so never overwrite one
+		for _, i := range current {
+			h := &p.hosts[i]
+			switch key {
+			case "hostname":
+				if h.HostName == "" {
+					h.HostName = value
+				}
+			case "user":
+				if h.User == "" {
+					h.User = value
+				}
+			case "port":
+				if h.Port == 0 {
+					h.Port, _ = strconv.Atoi(value)
+				}
+			case "identityfile":
+				if h.IdentityFile == "" {
+					h.IdentityFile = value
+				}
+			case "proxyjump":
+				if h.ProxyJump == "" {
+					h.ProxyJump = value
+				}
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	return nil
+}
+
+// include parses the files matched by an Include pattern. Relative paths are
+// relative to ~/.ssh, as they are for ssh with a user config.
+func (p *sshConfigParser) include(pattern string, depth int) error {
+	pattern = expandPath(pattern)
+	if !filepath.IsAbs(pattern) {
+		homeDir, _ := os.UserHomeDir()
+		pattern = filepath.Join(homeDir, ".ssh", pattern)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("bad Include pattern '%s': %v", pattern, err)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if info, err := os.Stat(m); err != nil || info.IsDir() {
+			continue
+		}
+		if err := p.parseFile(m, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitSSHConfigLine returns the lowercased keyword and its value. ssh_config
+// accepts both "Key Value" and "Key=Value", and values may be double-quoted.
+func splitSSHConfigLine(line string) (string, string) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", ""
+	}
+
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return strings.ToLower(line), ""
+	}
+	key := strings.ToLower(line[:i])
+	value := strings.TrimLeft(line[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+		value = value[1 : len(value)-1]
+	}
+	return key, value
+}
+
+// proposeGroupName guesses a group from an alias naming pattern,
+// e.g. "prod-web-01" and "prod.db01" both land in "prod"
+func proposeGroupName(alias string) string {
+	i := strings.IndexAny(alias, "-._")
+	if i <= 0 {
+		return "ssh-config"
+	}
+	return alias[:i]
+}
+
+// groupsFromSSHConfig turns parsed ssh_config hosts into inventory groups, using
+// the group markers or else naming patterns, in the order each group first appears
+func groupsFromSSHConfig(hosts []SSHConfigHost) []Group {
+	var groups []Group
+	index := make(map[string]int)
+
+	for _, h := range hosts {
+		name := h.Group
+		if name == "" {
+			name = proposeGroupName(h.Alias)
+		}
+		i, exists := index[name]
+		if !exists {
+			groups = append(groups, Group{Name: name})
+			i = len(groups) - 1
+			index[name] = i
+		}
+		groups[i].Hosts = append(groups[i].Hosts, h.toHost())
+	}
+	return groups
+}
+
+// toHost converts an ssh_config entry into an inventory host
+func (h SSHConfigHost) toHost() Host {
+	// HostName may refer back to the alias with the %h token
+	hostname := strings.NewReplacer("%h", h.Alias, "%%", "%").Replace(h.HostName)
+	if hostname == "" {
+		hostname = h.Alias
+	}
+	return Host{
+		Alias:    h.Alias,
+		Hostname: hostname,
+		SSHSettings: SSHSettings{
+			User:         h.User,
+			Port:         h.Port,
+			IdentityFile: h.IdentityFile,
+			Jump:         h.ProxyJump,
+		},
+	}
+}
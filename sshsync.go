@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// wssh owns one region of ~/.ssh/config and regenerates it from the inventory.
+// In "block" mode (default) the hosts live between the markers below; in
+// "include" mode they live in ~/.ssh/wssh_config, pulled in by an Include line.
+const (
+	managedBegin       = "# BEGIN wssh"
+	managedEnd         = "# END wssh"
+	managedHeader      = managedBegin + " (generated from the wssh inventory, run 'wssh sync-ssh-config' after editing it)"
+	managedIncludeFile = "wssh_config"
+	managedIncludeNote = "# Hosts from the wssh inventory"
+)
+
+// sshConfigSync is the result of regenerating the managed region
+type sshConfigSync struct {
+	writes   []fileWrite // Only the files that change
+	diff     string
+	warnings []string
+}
+
+// sshConfigPath is the user's ssh_config
+func sshConfigPath() string {
+	return expandPath("~/.ssh/config")
+}
+
+// planSSHConfigSync works out the new ~/.ssh/config (and wssh_config in include
+// mode) for the inventory. Running it again on the result changes nothing.
+func planSSHConfigSync(cfg *Config) (sshConfigSync, error) {
+	var plan sshConfigSync
+	path := sshConfigPath()
+	current, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return plan, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	hosts := renderManagedHosts(cfg)
+	updated := string(current)
+
+	switch cfg.Settings.SSHConfigMode {
+	case "", "block":
+		updated = removeManagedInclude(updated)
+		updated = replaceManagedBlock(updated, managedHeader+"\n"+hosts+managedEnd+"\n")
+	case "include":
+		updated = replaceManagedBlock(updated, "")
+		updated = ensureManagedInclude(updated)
+
+		includePath := filepath.Join(filepath.Dir(path), managedIncludeFile)
+		includeCurrent, err := os.ReadFile(includePath)
+		if err != nil && !os.IsNotExist(err) {
+			return plan, fmt.Errorf("failed to read %s: %v", includePath, err)
+		}
+		includeUpdated := "# Generated from the wssh inventory by 'wssh sync-ssh-config'. Do not edit.\n\n" + hosts
+		if includeUpdated != string(includeCurrent) {
+			plan.writes = append(plan.writes, fileWrite{Path: includePath, Data: []byte(includeUpdated), Perm: 0600})
+			plan.diff += unifiedDiff(shortPath(includePath), shortPath(includePath)+" (synced)", includeCurrent, []byte(includeUpdated))
+		}
+	default:
+		return plan, fmt.Errorf("unknown ssh_config_mode '%s' (expected block or include)", cfg.Settings.SSHConfigMode)
+	}
+
+	if updated != string(current) {
+		plan.writes = append([]fileWrite{{Path: path, Data: []byte(updated), Perm: 0600}}, plan.writes...)
+		plan.diff = unifiedDiff(shortPath(path), shortPath(path)+" (synced)", current, []byte(updated)) + plan.diff
+	}
+
+	plan.warnings = unmanagedDuplicates(string(current), cfg)
+	return plan, nil
+}
+
+// renderManagedHosts writes one Host block per inventory host
+func renderManagedHosts(cfg *Config) string {
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, h := range buildSearchableHosts(cfg) {
+		if h.Alias == "" || seen[h.Alias] {
+			continue
+		}
+		seen[h.Alias] = true
+
+		fmt.Fprintf(&b, "Host %s\n", h.Alias)
+		if h.Hostname != "" {
+			fmt.Fprintf(&b, "    HostName %s\n", h.Hostname)
+		}
+		if h.SSH.User != "" {
+			fmt.Fprintf(&b, "    User %s\n", h.SSH.User)
+		}
+		if h.SSH.Port != 0 {
+			fmt.Fprintf(&b, "    Port %d\n", h.SSH.Port)
+		}
+		if identity := managedIdentityFile(h, cfg); identity != "" {
+			fmt.Fprintf(&b, "    IdentityFile %s\n", identity)
+		}
+		if h.SSH.Jump != "" {
+			// Inventory aliases work as is, they are defined in this file too
+			fmt.Fprintf(&b, "    ProxyJump %s\n", h.SSH.Jump)
+		}
+
+		var keys []string
+		for k := range h.SSH.SSHOptions {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "    %s %s\n", k, h.SSH.SSHOptions[k])
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// managedIdentityFile is the host's identity_file, or else the key of the agent
+// env named explicitly with agent_env (what 'wssh add' records)
+func managedIdentityFile(h SearchableHost, cfg *Config) string {
+	if h.SSH.IdentityFile != "" {
+		return h.SSH.IdentityFile
+	}
+	if env, exists := cfg.Settings.SSHAgentEnvs[h.SSH.AgentEnv]; exists && h.SSH.AgentEnv != "" {
+		return env.Key
+	}
+	return ""
+}
+
+// replaceManagedBlock swaps the lines between the markers for block, appending
+// it when there is no block yet. An empty block removes the region.
+func replaceManagedBlock(content, block string) string {
+	lines := splitLines([]byte(content))
+	begin, end := -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if begin < 0 && strings.HasPrefix(trimmed, managedBegin) {
+			begin = i
+		} else if begin >= 0 && trimmed == managedEnd {
+			end = i
+			break
+		}
+	}
+
+	if begin < 0 || end < 0 {
+		if block == "" {
+			return content
+		}
+		if strings.TrimSpace(content) == "" {
+			return block
+		}
+		return strings.TrimRight(content, "\n") + "\n\n" + block
+	}
+
+	before := strings.Join(lines[:begin], "\n")
+	after := strings.Join(lines[end+1:], "\n")
+	if block == "" {
+		// Drop the blank line we put in front of the block as well
+		return joinSections(strings.TrimRight(before, "\n"), after)
+	}
+	return joinSections(before, strings.TrimSuffix(block, "\n")+"\n"+after)
+}
+
+// joinSections joins two parts of a file with a newline, skipping empty parts
+func joinSections(before, after string) string {
+	switch {
+	case before == "":
+		return strings.TrimLeft(after, "\n")
+	case after == "":
+		return before + "\n"
+	default:
+		return before + "\n" + after
+	}
+}
+
+// ensureManagedInclude puts "Include wssh_config" at the top, where it applies to every host
+func ensureManagedInclude(content string) string {
+	for _, line := range splitLines([]byte(content)) {
+		if strings.EqualFold(strings.TrimSpace(line), "Include "+managedIncludeFile) {
+			return content
+		}
+	}
+	return managedIncludeNote + "\nInclude " + managedIncludeFile + "\n\n" + content
+}
+
+// removeManagedInclude takes out the Include line added by ensureManagedInclude
+func removeManagedInclude(content string) string {
+	const added = managedIncludeNote + "\nInclude " + managedIncludeFile + "\n"
+	if !strings.HasPrefix(content, added) {
+		return content
+	}
+	return strings.TrimLeft(strings.TrimPrefix(content, added), "\n")
+}
+
+// unmanagedDuplicates finds inventory hosts that also have a Host line outside
+// the managed region, e.g. from older versions of 'wssh add'. ssh uses the first
+// value it finds, so those entries may shadow the generated ones.
+func unmanagedDuplicates(content string, cfg *Config) []string {
+	inventory := make(map[string]bool)
+	for _, h := range buildSearchableHosts(cfg) {
+		inventory[h.Alias] = true
+	}
+
+	var warnings []string
+	inBlock := false
+	for i, line := range splitLines([]byte(content)) {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, managedBegin):
+			inBlock = true
+			continue
+		case trimmed == managedEnd:
+			inBlock = false
+			continue
+		case inBlock:
+			continue
+		}
+
+		key, value := splitSSHConfigLine(trimmed)
+		if key != "host" {
+			continue
+		}
+		for _, alias := range strings.Fields(value) {
+			if inventory[alias] {
+				warnings = append(warnings, fmt.Sprintf("%s:%d: Host %s is also defined outside the wssh block, remove it so it doesn't shadow the generated entry", shortPath(sshConfigPath()), i+1, alias))
+			}
+		}
+	}
+	return warnings
+}
+
+// RunSyncSSHConfig regenerates the managed ssh_config region after showing the diff
+func RunSyncSSHConfig(cfg *Config, yes bool) error {
+	plan, err := planSSHConfigSync(cfg)
+	if err != nil {
+		return err
+	}
+	for _, w := range plan.warnings {
+		fmt.Printf("warning: %s\n", w)
+	}
+
+	if len(plan.writes) == 0 {
+		fmt.Println("✅ ~/.ssh/config is already in sync with the inventory")
+		return nil
+	}
+
+	fmt.Print(plan.diff)
+	if !yes && dryRun == nil && !askYesNo("\nWrite these changes?") {
+		fmt.Println("Nothing was written.")
+		return nil
+	}
+
+	backupDir, keep := backupSettings(cfg.Settings)
+	if err := commitWrites(backupDir, keep, "sync ssh config with the inventory", plan.writes...); err != nil {
+		return err
+	}
+	if dryRun == nil {
+		fmt.Println("✅ ~/.ssh/config synced with the inventory")
+	}
+	return nil
+}
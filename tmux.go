@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// tmuxSessionName is the session wssh creates when it is started outside of tmux
+const tmuxSessionName = "wssh"
+
+// tmuxBackend builds windows and panes through the tmux CLI. Unlike iTerm every
+// call runs immediately, because tmux hands back the pane id we need for the next split.
+type tmuxBackend struct {
+	panes  map[int]string // wssh pane number -> tmux pane id (e.g. "%12")
+	attach bool           // Attach attaches to the session when we started outside tmux
+}
+
+func (t *tmuxBackend) Name() string { return "tmux" }
+
+func (t *tmuxBackend) OpenTab(host SearchableHost, cmd string) error {
+	t.panes = make(map[int]string)
+
+	args := []string{"new-window", "-P", "-F", "#{pane_id}", "-n", host.Alias, cmd}
+	if os.Getenv("TMUX") == "" {
+		// Outside tmux: add a window to our own session, creating it on first use
+		// Later tabs of the same launch go into the session the first one created
+		created := t.attach || (dryRun == nil && exec.Command("tmux", "has-session", "-t", "="+tmuxSessionName).Run() == nil)
+		t.attach = true
+		if !created {
+			args = []string{"new-session", "-d", "-s", tmuxSessionName, "-P", "-F", "#{pane_id}", "-n", host.Alias, cmd}
+		} else {
+			args = []string{"new-window", "-t", tmuxSessionName + ":", "-P", "-F", "#{pane_id}", "-n", host.Alias, cmd}
+		}
+	}
+
+	id, err := runTmux(args...)
+	if err != nil {
+		return err
+	}
+	t.panes[1] = id
+	return nil
+}
+
+func (t *tmuxBackend) SplitPane(from, to int, dir SplitDirection, percent int, host SearchableHost, cmd string) error {
+	target, exists := t.panes[from]
+	if !exists {
+		return fmt.Errorf("tmux: unknown pane %d", from)
+	}
+
+	flag := "-v"
+	if dir == SplitRight {
+		flag = "-h"
+	}
+
+	id, err := runTmux("split-window", "-t", target, flag, "-l", fmt.Sprintf("%d%%", percent), "-P", "-F", "#{pane_id}", cmd)
+	if err != nil {
+		return err
+	}
+	t.panes[to] = id
+	return nil
+}
+
+func (t *tmuxBackend) NameSession(pane int, name string) error {
+	target, exists := t.panes[pane]
+	if !exists {
+		return fmt.Errorf("tmux: unknown pane %d", pane)
+	}
+	_, err := runTmux("select-pane", "-t", target, "-T", name)
+	return err
+}
+
+func (t *tmuxBackend) Flush() error {
+	// Leave the cursor in the top-left pane like iTerm does
+	if first, exists := t.panes[1]; exists {
+		if _, err := runTmux("select-pane", "-t", first); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attach attaches to the wssh session when the tabs were opened from outside
+// tmux. It blocks until the user detaches, so it runs once after the last tab.
+func (t *tmuxBackend) Attach() error {
+	if !t.attach {
+		return nil
+	}
+	t.attach = false
+
+	cmd := exec.Command("tmux", "attach-session", "-t", "="+tmuxSessionName)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return runCommand(cmd)
+}
+
+// SendText types the text into the active tmux pane and presses enter
+func (t *tmuxBackend) SendText(text string) error {
+	if _, err := runTmux("send-keys", "-l", text); err != nil {
+		return err
+	}
+	_, err := runTmux("send-keys", "Enter")
+	return err
+}
+
+// runTmux executes a tmux subcommand and returns its trimmed stdout
+func runTmux(args ...string) (string, error) {
+	if dryRun != nil {
+		// Hand out placeholder pane ids so later splits can still refer to them
+		dryRun.record(PlanStep{Kind: "exec", Argv: append([]string{"tmux"}, args...)})
+		return fmt.Sprintf("%%dry%d", len(dryRun.Steps)), nil
+	}
+
+	out, err := exec.Command("tmux", args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("tmux %s failed: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("tmux %s failed: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -2,16 +2,26 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/atotto/clipboard"
+	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
 var docStyle = lipgloss.NewStyle().Margin(1, 2)
+var markStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("170"))
+var detailStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240")).Padding(0, 1)
+var detailLabelStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+var detailHeadingStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("170"))
 
 type hostItem struct {
 	host SearchableHost
@@ -21,14 +31,130 @@ func (i hostItem) Title() string { return i.host.Alias }
 func (i hostItem) Description() string {
 	return fmt.Sprintf("%s | Group: %s", i.host.Hostname, i.host.GroupName)
 }
-func (i hostItem) FilterValue() string { return i.host.SearchIndex }
+func (i hostItem) FilterValue() string { return i.host.Alias } // Looked up again by queryFilter
+
+// selectionDelegate draws hosts like the default delegate, with a mark in front
+// of the selected ones. selected is the model's map, shared by reference.
+type selectionDelegate struct {
+	list.DefaultDelegate
+	selected map[string]bool
+}
+
+func (d selectionDelegate) Render(w io.Writer, m list.Model, index int, item list.Item) {
+	var b strings.Builder
+	d.DefaultDelegate.Render(&b, m, index, item)
+
+	mark := "  "
+	if i, ok := item.(hostItem); ok && d.selected[i.host.Alias] {
+		mark = markStyle.Render("✓ ")
+	}
+	lines := strings.Split(b.String(), "\n")
+	for n := range lines {
+		if n == 0 {
+			lines[n] = mark + lines[n]
+		} else {
+			lines[n] = "  " + lines[n]
+		}
+	}
+	fmt.Fprint(w, strings.Join(lines, "\n"))
+}
+
+// TUIAction is what was picked in the TUI, carried out by RunTUIAction once the
+// TUI has exited
+type TUIAction struct {
+	Kind   string // "connect", "tile", "run", "push", "macro" or "copy"
+	Hosts  []SearchableHost
+	Layout string // connect: the layout for every host, "" for the usual behavior
+	Arg    string // run: the script path, push: the payload, macro: the macro name
+}
+
+// menuItem is one entry of the action menu and its follow-up pickers
+type menuItem struct {
+	value, title, desc string
+}
+
+func (i menuItem) Title() string       { return i.title }
+func (i menuItem) Description() string { return i.desc }
+func (i menuItem) FilterValue() string { return i.title }
+
+// tuiActions are the actions offered for the selected hosts
+var tuiActions = []menuItem{
+	{"connect", "Connect", "Open each host in its own tab, in a layout of your choice"},
+	{"tile", "Tile into one tab", "One pane per host, all in a single tab"},
+	{"run", "Run a script", "Stream a local script to each host"},
+	{"push", "Push a payload", "Upload and extract a payload on each host"},
+	{"macro", "Send a macro", "Run a macro's command on each host"},
+	{"copy", "Copy aliases", "Copy the aliases to the clipboard"},
+}
+
+// Action menu stages
+const (
+	menuClosed = iota
+	menuActions
+	menuLayouts
+	menuPayloads
+	menuMacros
+	menuScript
+)
+
+// detailWidth is the width of the host detail pane, borders included
+const detailWidth = 48
+
+// The size of the preview drawn next to the layout picker
+const (
+	previewWidth  = 25
+	previewHeight = 11
+)
 
 type model struct {
-	list     list.Model
-	choices  []SearchableHost
-	quitting bool
+	list          list.Model
+	action        TUIAction
+	quitting      bool
 	originalItems []list.Item // Keep track of the default YAML order
-	sortMode      string      // "default" or "recent"	
+	sortMode      string      // "default" or "recent"
+	context       string      // Active named context, shown in the title
+	cfg           *Config
+
+	selected   map[string]bool // Aliases marked with space
+	menu       list.Model      // The action menu, or one of its pickers
+	menuStage  int
+	menuHosts  []SearchableHost // The hosts the menu acts on
+	menuDirect bool             // Opened straight on a picker (ctrl+l), esc closes it
+	script     textinput.Model
+	width      int
+	height     int
+
+	showDetails bool   // The detail pane next to the list (ctrl+o)
+	details     string // Rendered details of the highlighted host
+	detailsFor  string // Alias the details were rendered for
+}
+
+// title prefixes the list title with the active context, e.g. "wssh [lab] - ..."
+func (m model) title(text string) string {
+	if m.context != "" {
+		return fmt.Sprintf("wssh [%s] - %s", m.context, text)
+	}
+	return "wssh - " + text
+}
+
+// refreshTitle shows the key hints, or the selection count once hosts are selected
+func (m *model) refreshTitle() {
+	text := "Select a Host (ctrl+l layout | ctrl+r recent | ctrl+p push | ctrl+a connect all)"
+	if n := len(m.selected); n > 0 {
+		text = fmt.Sprintf("%d selected (enter for actions | esc to clear)", n)
+	}
+	m.list.Title = m.title(text)
+}
+
+// selectedHosts returns the selected hosts in config order
+func (m model) selectedHosts() []SearchableHost {
+	var hosts []SearchableHost
+	for _, item := range m.originalItems {
+		if i, ok := item.(hostItem); ok && m.selected[i.host.Alias] {
+			hosts = append(hosts, i.host)
+		}
+	}
+	return hosts
 }
 
 func (m model) Init() tea.Cmd {
@@ -36,18 +162,49 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.menuStage != menuClosed {
+		return m.updateMenu(msg)
+	}
+	m, cmd := m.updateList(msg)
+	m.refreshDetails()
+	return m, cmd
+}
+
+// updateList handles the host list
+func (m model) updateList(msg tea.Msg) (model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch keypress := msg.String(); keypress {
 		case "ctrl+c", "q":
 			m.quitting = true
 			return m, tea.Quit
+		case " ":
+			// Space is part of the query while typing a filter
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			if i, ok := m.list.SelectedItem().(hostItem); ok {
+				if m.selected[i.host.Alias] {
+					delete(m.selected, i.host.Alias)
+				} else {
+					m.selected[i.host.Alias] = true
+				}
+				m.refreshTitle()
+				m.list.CursorDown()
+			}
+			return m, nil
+		case "esc":
+			// Clear the selection first, before esc clears the filter or quits
+			if len(m.selected) > 0 && m.list.FilterState() != list.Filtering {
+				clear(m.selected)
+				m.refreshTitle()
+				return m, nil
+			}
 		case "ctrl+r":
 			var cmd tea.Cmd
 			if m.sortMode == "default" {
 				m.sortMode = "recent"
-				m.list.Title = "wssh - Select a Host (ctrl+r recent | ctrl+p push | ctrl+a connect all)"
-				
+
 				recentAliases := GetRecentHosts()
 				var newItems []list.Item
 				added := make(map[string]bool)
@@ -69,12 +226,11 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 						newItems = append(newItems, item)
 					}
 				}
-				
+
 				cmd = m.list.SetItems(newItems)
 			} else {
 				// Revert to default YAML order
 				m.sortMode = "default"
-				m.list.Title = "wssh - Select a Host (ctrl+r for recent)"
 				cmd = m.list.SetItems(m.originalItems)
 			}
 			return m, cmd
@@ -97,26 +253,50 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		case "ctrl+a":
 			// Get all currently visible (filtered) items
-			visibleItems := m.list.VisibleItems()
-			if len(visibleItems) > 0 {
-				for _, item := range visibleItems {
-					if i, ok := item.(hostItem); ok {
-						m.choices = append(m.choices, i.host)
-					}
+			m.action = TUIAction{Kind: "connect"}
+			for _, item := range m.list.VisibleItems() {
+				if i, ok := item.(hostItem); ok {
+					m.action.Hosts = append(m.action.Hosts, i.host)
 				}
 			}
 			return m, tea.Quit
-			
+
+		case "ctrl+o":
+			m.showDetails = !m.showDetails
+			m.detailsFor = "" // Read the history and logs again
+			m.list.SetSize(m.listWidth(), m.height)
+			return m, nil
+		case "ctrl+l":
+			// Pick a layout for the selection, or else the highlighted host
+			m.menuHosts = m.selectedHosts()
+			if len(m.menuHosts) == 0 {
+				i, ok := m.list.SelectedItem().(hostItem)
+				if !ok {
+					return m, nil
+				}
+				m.menuHosts = []SearchableHost{i.host}
+			}
+			m.menuDirect = true
+			m.openLayoutPicker()
+			return m, nil
+
 		case "enter":
+			if len(m.selected) > 0 {
+				m.menuHosts = m.selectedHosts()
+				m.menuDirect = false
+				m.openMenu(menuActions, tuiActions)
+				return m, nil
+			}
 			i, ok := m.list.SelectedItem().(hostItem)
 			if ok {
-				m.choices = []SearchableHost{i.host} // Assign as a slice of 1
+				m.action = TUIAction{Kind: "connect", Hosts: []SearchableHost{i.host}}
 			}
 			return m, tea.Quit
 		}
 	case tea.WindowSizeMsg:
 		h, v := docStyle.GetFrameSize()
-		m.list.SetSize(msg.Width-h, msg.Height-v)
+		m.width, m.height = msg.Width-h, msg.Height-v
+		m.list.SetSize(m.listWidth(), m.height)
 	}
 
 	var cmd tea.Cmd
@@ -124,60 +304,372 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, cmd
 }
 
+// listWidth leaves room for the detail pane when it is shown
+func (m model) listWidth() int {
+	if m.showDetails {
+		return max(m.width-detailWidth, 0)
+	}
+	return m.width
+}
+
+// refreshDetails renders the detail pane again when another host is highlighted
+func (m *model) refreshDetails() {
+	if !m.showDetails {
+		return
+	}
+	i, ok := m.list.SelectedItem().(hostItem)
+	if !ok {
+		m.details, m.detailsFor = "", ""
+		return
+	}
+	if i.host.Alias != m.detailsFor {
+		m.details, m.detailsFor = hostDetails(i.host, m.cfg), i.host.Alias
+	}
+}
+
+// hostDetails renders everything known about a host for the detail pane: its
+// settings, the agent it would use, and its recent connections and session logs
+func hostDetails(h SearchableHost, cfg *Config) string {
+	var b strings.Builder
+	field := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s %s\n", detailLabelStyle.Render(fmt.Sprintf("%-10s", label)), value)
+		}
+	}
+	heading := func(text string) {
+		b.WriteString("\n" + detailHeadingStyle.Render(text) + "\n")
+	}
+
+	b.WriteString(detailHeadingStyle.Render(h.Alias) + "\n")
+	field("Hostname", h.Hostname)
+	field("Group", h.GroupName)
+	field("Tags", strings.Join(h.Tags, ", "))
+	field("User", h.SSH.User)
+	if h.SSH.Port != 0 {
+		field("Port", fmt.Sprint(h.SSH.Port))
+	}
+	field("Jump", h.SSH.Jump)
+	field("Identity", h.SSH.IdentityFile)
+	field("Profile", h.Profile)
+	if h.LogSession {
+		field("Logging", "on")
+	} else {
+		field("Logging", "off")
+	}
+
+	if match, ok := ResolveAgentEnv(h, cfg); ok {
+		field("Agent env", fmt.Sprintf("%s (%s)", match.Name, match.Reason))
+	} else {
+		field("Agent env", "none")
+	}
+	if socket := getSocketForHost(h, cfg); socket != "" {
+		field("Socket", socket)
+	} else {
+		field("Socket", "$SSH_AUTH_SOCK (system default)")
+	}
+
+	history := GetHostHistory(h.Alias, 5)
+	if len(history) > 0 {
+		field("Last seen", history[0].Format("2006-01-02 15:04"))
+	} else {
+		field("Last seen", "never")
+	}
+	field("Layout", GetLastLayouts()[h.Alias])
+
+	if h.Notes != "" {
+		heading("Notes")
+		b.WriteString(strings.TrimSpace(h.Notes) + "\n")
+	}
+
+	if len(history) > 0 {
+		heading("Recent connections")
+		for _, t := range history {
+			b.WriteString(t.Format("2006-01-02 15:04") + "\n")
+		}
+	}
+
+	if logs := RecentSessionLogs(h.Alias, 5); len(logs) > 0 {
+		heading("Session logs in " + shortPath(sessionLogDir()))
+		for _, path := range logs {
+			b.WriteString(filepath.Base(path) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// openMenu shows the action menu, or one of the pickers that follow it
+func (m *model) openMenu(stage int, items []menuItem) {
+	listItems := make([]list.Item, len(items))
+	for i, item := range items {
+		listItems[i] = item
+	}
+
+	m.menuStage = stage
+	m.menu = list.New(listItems, list.NewDefaultDelegate(), m.menuWidth(), m.height)
+	m.menu.SetFilteringEnabled(false)
+	m.menu.SetShowStatusBar(false)
+
+	switch stage {
+	case menuActions:
+		m.menu.Title = m.title(fmt.Sprintf("%d selected (esc to go back)", len(m.menuHosts)))
+	case menuLayouts:
+		target := m.menuHosts[0].Alias
+		if len(m.menuHosts) > 1 {
+			target = fmt.Sprintf("%d hosts", len(m.menuHosts))
+		}
+		m.menu.Title = m.title(fmt.Sprintf("Choose a layout for %s (esc to go back)", target))
+	case menuPayloads:
+		m.menu.Title = m.title("Choose a payload (esc to go back)")
+	case menuMacros:
+		m.menu.Title = m.title("Choose a macro (esc to go back)")
+	}
+}
+
+// menuWidth leaves room for the preview next to the layout picker
+func (m model) menuWidth() int {
+	if m.menuStage == menuLayouts {
+		return max(m.width-previewWidth-2, 0)
+	}
+	return m.width
+}
+
+// openLayoutPicker lists the layouts for menuHosts, starting on the one last
+// launched for the first of them
+func (m *model) openLayoutPicker() {
+	last := GetLastLayouts()[m.menuHosts[0].Alias]
+	var items []menuItem
+	current := 0
+	for i, name := range LayoutNames(m.cfg) {
+		desc := LayoutDescription(name, m.cfg)
+		if name == last {
+			desc += " (last used)"
+			current = i
+		}
+		items = append(items, menuItem{name, name, desc})
+	}
+	m.openMenu(menuLayouts, items)
+	m.menu.Select(current)
+}
+
+// layoutPreview draws the layout highlighted in the picker
+func (m model) layoutPreview() string {
+	item, ok := m.menu.SelectedItem().(menuItem)
+	if !ok {
+		return ""
+	}
+	preview := lipgloss.NewStyle().PaddingTop(2).PaddingLeft(2)
+	def, err := ResolveLayout(item.value, m.cfg)
+	if err != nil {
+		return preview.Width(previewWidth + 2).Render(err.Error())
+	}
+	return preview.Render(def.Preview(previewWidth, previewHeight))
+}
+
+// sortedMenuItems lists a name -> value map from the config by name
+func sortedMenuItems(values map[string]string) []menuItem {
+	var items []menuItem
+	for name, value := range values {
+		items = append(items, menuItem{name, name, value})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].value < items[j].value })
+	return items
+}
+
+func (m model) updateMenu(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		h, v := docStyle.GetFrameSize()
+		m.width, m.height = msg.Width-h, msg.Height-v
+		m.list.SetSize(m.listWidth(), m.height)
+		m.menu.SetSize(m.menuWidth(), m.height)
+		return m, nil
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "ctrl+c":
+			m.quitting = true
+			return m, tea.Quit
+		case "esc":
+			if m.menuStage == menuActions || m.menuDirect {
+				m.menuStage = menuClosed
+			} else {
+				m.openMenu(menuActions, tuiActions)
+			}
+			return m, nil
+		case "q":
+			if m.menuStage != menuScript {
+				m.menuStage = menuClosed
+				return m, nil
+			}
+		case "enter":
+			return m.chooseMenuItem()
+		}
+	}
+
+	var cmd tea.Cmd
+	if m.menuStage == menuScript {
+		m.script, cmd = m.script.Update(msg)
+	} else {
+		m.menu, cmd = m.menu.Update(msg)
+	}
+	return m, cmd
+}
+
+// chooseMenuItem moves on from the current menu stage, quitting once the action is complete
+func (m model) chooseMenuItem() (tea.Model, tea.Cmd) {
+	done := func(kind, layout, arg string) (tea.Model, tea.Cmd) {
+		m.action = TUIAction{Kind: kind, Hosts: m.menuHosts, Layout: layout, Arg: arg}
+		return m, tea.Quit
+	}
+
+	if m.menuStage == menuScript {
+		path := strings.TrimSpace(m.script.Value())
+		if path == "" {
+			return m, nil
+		}
+		return done("run", "", expandPath(path))
+	}
+
+	item, ok := m.menu.SelectedItem().(menuItem)
+	if !ok {
+		return m, nil
+	}
+
+	switch m.menuStage {
+	case menuLayouts:
+		return done("connect", item.value, "")
+	case menuPayloads:
+		return done("push", "", item.value)
+	case menuMacros:
+		return done("macro", "", item.value)
+	}
+
+	switch item.value {
+	case "connect":
+		m.openLayoutPicker()
+	case "run":
+		m.script = textinput.New()
+		m.script.Placeholder = "~/scripts/check.sh"
+		m.script.Prompt = "Script: "
+		m.script.Width = m.width
+		m.script.Focus()
+		m.menuStage = menuScript
+		return m, textinput.Blink
+	case "push":
+		if len(m.cfg.Payloads) == 0 {
+			return m, m.menu.NewStatusMessage("No payloads configured")
+		}
+		m.openMenu(menuPayloads, sortedMenuItems(m.cfg.Payloads))
+	case "macro":
+		if len(m.cfg.Macros) == 0 {
+			return m, m.menu.NewStatusMessage("No macros configured")
+		}
+		m.openMenu(menuMacros, sortedMenuItems(m.cfg.Macros))
+	default:
+		return done(item.value, "", "")
+	}
+	return m, nil
+}
+
 func (m model) View() string {
-	if len(m.choices) == 1 {
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("170")).Render(fmt.Sprintf("Connecting to %s...\n", m.choices[0].Alias))
-	} else if len(m.choices) > 1 {
-		return lipgloss.NewStyle().Foreground(lipgloss.Color("170")).Render(fmt.Sprintf("Connecting to %d hosts...\n", len(m.choices)))
+	if len(m.action.Hosts) > 0 {
+		target := m.action.Hosts[0].Alias
+		if len(m.action.Hosts) > 1 {
+			target = fmt.Sprintf("%d hosts", len(m.action.Hosts))
+		}
+		verb := "Connecting to"
+		if m.action.Kind == "copy" {
+			verb = "Copying"
+		} else if m.action.Kind != "connect" && m.action.Kind != "tile" {
+			verb = "Running on"
+		}
+		return lipgloss.NewStyle().Foreground(lipgloss.Color("170")).Render(fmt.Sprintf("%s %s...\n", verb, target))
 	}
 	if m.quitting {
 		return "Goodbye!\n"
 	}
-	return docStyle.Render(m.list.View())
+	switch m.menuStage {
+	case menuClosed:
+		if m.showDetails {
+			pane := detailStyle.Width(detailWidth - 2).Height(m.height - 2).MaxHeight(m.height).Render(m.details)
+			return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, m.list.View(), pane))
+		}
+		return docStyle.Render(m.list.View())
+	case menuLayouts:
+		return docStyle.Render(lipgloss.JoinHorizontal(lipgloss.Top, m.menu.View(), m.layoutPreview()))
+	case menuScript:
+		title := m.menu.Styles.Title.Render(m.title(fmt.Sprintf("Run a script on %d host(s)", len(m.menuHosts))))
+		return docStyle.Render(title + "\n\n" + m.script.View() + "\n\n" + m.menu.Styles.HelpStyle.Render("enter to run • esc to go back"))
+	default:
+		return docStyle.Render(m.menu.View())
+	}
 }
 
-// customFilter overrides the default fuzzy finder to match our CLI AND-logic
-func customFilter(term string, targets []string) []list.Rank {
-	var ranks []list.Rank
-	
-	// Split the search bar input into individual terms (e.g. "dev" "web")
-	terms := strings.Fields(strings.ToLower(term))
+// queryFilter filters the list with the search query language (see query.go)
+// and ranks the matches best first, highlighting the matched alias characters.
+// The list hands over the items' filter values, their aliases, so the hosts are
+// looked up by alias.
+func queryFilter(hosts []SearchableHost) list.FilterFunc {
+	byAlias := make(map[string]SearchableHost, len(hosts))
+	for _, h := range hosts {
+		byAlias[h.Alias] = h
+	}
+	frecency := GetFrecency()
 
-	for i, target := range targets {
-		targetLower := strings.ToLower(target)
-		
-		// Assume match, then try to disprove it (Logical AND)
-		match := true
-		for _, t := range terms {
-			if !strings.Contains(targetLower, t) {
-				match = false
-				break // Failed the AND check, move to the next host
-			}
+	return func(term string, targets []string) []list.Rank {
+		query, err := ParseFilterQuery(term)
+		if err != nil {
+			return nil // e.g. a bad regex while it is being typed
 		}
 
-		if match {
-			// If it passes, append it. (We leave MatchedIndexes empty to keep rendering fast)
-			ranks = append(ranks, list.Rank{Index: i})
+		// Rank in the list's current order, so equal scores keep it
+		ordered := make([]SearchableHost, len(targets))
+		index := make(map[string]int, len(targets))
+		for i, alias := range targets {
+			ordered[i] = byAlias[alias]
+			index[alias] = i
 		}
+
+		var ranks []list.Rank
+		for _, r := range query.Rank(ordered, frecency) {
+			ranks = append(ranks, list.Rank{Index: index[r.Host.Alias], MatchedIndexes: r.Matched})
+		}
+		return ranks
 	}
-	return ranks
 }
 
-func RunTUI(searchableHosts []SearchableHost) []SearchableHost {
+func newSelectionDelegate(selected map[string]bool) selectionDelegate {
+	return selectionDelegate{DefaultDelegate: list.NewDefaultDelegate(), selected: selected}
+}
+
+// RunTUI shows the host picker and returns what was picked. context is the
+// active named context, if any.
+func RunTUI(searchableHosts []SearchableHost, context string, cfg *Config) TUIAction {
 	items := make([]list.Item, len(searchableHosts))
 	for i, h := range searchableHosts {
 		items[i] = hostItem{host: h}
 	}
 
+	selected := make(map[string]bool)
 	m := model{
-		list: list.New(items, list.NewDefaultDelegate(), 0, 0),
+		list:          list.New(items, newSelectionDelegate(selected), 0, 0),
 		originalItems: items,
 		sortMode:      "default",
+		context:       context,
+		cfg:           cfg,
+		selected:      selected,
+	}
+	m.refreshTitle()
+	m.list.AdditionalShortHelpKeys = func() []key.Binding {
+		return []key.Binding{
+			key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "select")),
+			key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "connect/actions")),
+			key.NewBinding(key.WithKeys("ctrl+l"), key.WithHelp("ctrl+l", "layout")),
+			key.NewBinding(key.WithKeys("ctrl+o"), key.WithHelp("ctrl+o", "details")),
+		}
 	}
-	m.list.Title = "wssh - Select a Host (ctrl+r recent | ctrl+p push | ctrl+a connect all)"	
 
-	// Inject our custom filter into the list model!
-	m.list.Filter = customFilter	
+	// Inject our query filter into the list model!
+	m.list.Filter = queryFilter(searchableHosts)
 	p := tea.NewProgram(m, tea.WithAltScreen())
 	finalModel, err := p.Run()
 	if err != nil {
@@ -185,8 +677,89 @@ func RunTUI(searchableHosts []SearchableHost) []SearchableHost {
 		os.Exit(1)
 	}
 
-	if m, ok := finalModel.(model); ok && len(m.choices) > 0 {
-		return m.choices
+	if m, ok := finalModel.(model); ok {
+		return m.action
+	}
+	return TUIAction{}
+}
+
+// RunTUIAction carries out what was picked in the TUI
+func RunTUIAction(a TUIAction, tileLayout string, inline bool, cfg *Config) error {
+	if len(a.Hosts) == 0 {
+		return nil
+	}
+
+	switch a.Kind {
+	case "connect":
+		if len(a.Hosts) == 1 {
+			layout := a.Layout
+			if layout == "" {
+				layout = "single"
+			}
+			fmt.Printf("Connecting to %s...\n", a.Hosts[0].Alias)
+			if layout == "single" && useInline(inline, cfg) {
+				if err := ExecInline(a.Hosts[0], cfg); err != nil {
+					return fmt.Errorf("failed to exec ssh: %v", err)
+				}
+				return nil
+			}
+			if err := LaunchLayout(a.Hosts[0], layout, cfg); err != nil {
+				return fmt.Errorf("failed to launch session: %v", err)
+			}
+			return nil
+		}
+		if a.Layout == "" {
+			// Every visible host (ctrl+a), confirm first
+			if ConfirmExecution(a.Hosts, "Connect to") {
+				ConnectHosts(a.Hosts, tileLayout, cfg)
+			}
+			return nil
+		}
+		if err := LaunchEach(a.Hosts, a.Layout, cfg); err != nil {
+			return fmt.Errorf("failed to launch sessions: %v", err)
+		}
+	case "tile":
+		if err := LaunchOneTab(a.Hosts, cfg); err != nil {
+			return fmt.Errorf("failed to tile sessions: %v", err)
+		}
+	case "run", "push", "macro":
+		for _, h := range a.Hosts {
+			var err error
+			switch a.Kind {
+			case "run":
+				err = RunScript(a.Arg, h.Alias, cfg)
+			case "push":
+				err = RunPushInstall(a.Arg, h.Alias, cfg)
+			case "macro":
+				err = RunMacro(a.Arg, h.Alias, cfg)
+			}
+			if err != nil {
+				fmt.Printf("❌ Error on %s: %v\n", h.Alias, err)
+			}
+		}
+	case "copy":
+		return copyAliases(a.Hosts)
+	}
+	return nil
+}
+
+// copyAliases puts the aliases on the clipboard, space separated, or prints
+// them when there is no clipboard (e.g. over ssh)
+func copyAliases(hosts []SearchableHost) error {
+	var aliases []string
+	for _, h := range hosts {
+		aliases = append(aliases, h.Alias)
+	}
+	text := strings.Join(aliases, " ")
+
+	if dryRun != nil {
+		dryRun.record(PlanStep{Kind: "clipboard", Note: fmt.Sprintf("copy '%s' to the clipboard", text)})
+		return nil
+	}
+	if err := clipboard.WriteAll(text); err != nil {
+		fmt.Printf("No clipboard available (%v), here are the aliases:\n%s\n", err, text)
+		return nil
 	}
+	fmt.Printf("📋 Copied %d aliases to the clipboard\n", len(aliases))
 	return nil
 }
@@ -7,34 +7,18 @@ import (
 	"strings"
 )
 
-// FindHosts takes a slice of search terms and returns all hosts that match ALL terms (Logical AND)
-func FindHosts(terms []string, allHosts []SearchableHost) []SearchableHost {
-	var matches []SearchableHost
-
-	// Convert all search terms to lowercase once
-	var lowerTerms []string
-	for _, t := range terms {
-		lowerTerms = append(lowerTerms, strings.ToLower(t))
+// FindHosts returns the hosts matching the search terms, parsed as one query
+// (see query.go), best matches first
+func FindHosts(terms []string, allHosts []SearchableHost) ([]SearchableHost, error) {
+	query, err := QueryFromArgs(terms)
+	if err != nil {
+		return nil, err
 	}
-
-	for _, host := range allHosts {
-		// Using SearchIndex ensures we match against Group, Tags, Alias, and Hostname
-		target := strings.ToLower(host.SearchIndex)
-
-		match := true
-		for _, term := range lowerTerms {
-			if !strings.Contains(target, term) {
-				match = false
-				break // Failed the AND check
-			}
-		}
-
-		if match {
-			matches = append(matches, host)
-		}
+	var hosts []SearchableHost
+	for _, r := range query.Rank(allHosts, GetFrecency()) {
+		hosts = append(hosts, r.Host)
 	}
-
-	return matches
+	return hosts, nil
 }
 
 // ConfirmExecution prompts the user for confirmation if there is more than 1 matching host.
@@ -65,23 +49,28 @@ func ConfirmExecution(hosts []SearchableHost, action string) bool {
 }
 
 
-// ListHosts lists the matching hosts
-func ListHosts(hosts []SearchableHost) {
-	if len(hosts) == 0 {
-		fmt.Println("❌ No hosts matched the search criteria.")
-		return
+// ListHosts lists the matching hosts, under the active named context if there is one
+func ListHosts(hosts []SearchableHost, context string) {
+	if context != "" {
+		fmt.Printf("Context: %s\n", context)
 	}
 
-	// If exactly one host matches, proceed without prompting
-	if len(hosts) == 1 {
+	if len(hosts) == 0 {
+		fmt.Println("❌ No hosts matched the search criteria.")
 		return
 	}
 
-	// More than one host matched, ask for confirmation
 	fmt.Printf("--- Matching Hosts (%d) ---\n", len(hosts))
 	for _, h := range hosts {
 		fmt.Printf("  - %-20s [Group: %s]\n", h.Alias, h.GroupName)
 	}
+}
 
-	return
-}
\ No newline at end of file
+// askYesNo prompts on stdin and reports whether the answer was yes (default no)
+func askYesNo(prompt string) bool {
+	fmt.Print(prompt + " (y/N): ")
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	response := strings.ToLower(strings.TrimSpace(scanner.Text()))
+	return response == "y" || response == "yes"
+}
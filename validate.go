@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is one problem found in the config, positioned like a compiler message
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return fmt.Sprintf("%s: %s: %s", d.File, d.Severity, d.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s: %s", d.File, d.Line, d.Column, d.Severity, d.Message)
+}
+
+// yamlErrorLine pulls the line number out of yaml.v3 error messages
+var yamlErrorLine = regexp.MustCompile(`line (\d+): `)
+
+// yamlUnknownField matches the errors KnownFields reports for keys we don't have
+var yamlUnknownField = regexp.MustCompile(`field (\S+) not found in type main\.(\w+)`)
+
+// configValidator collects diagnostics for the main config and its includes.
+// References (agent envs, layouts, aliases) are checked against the merged config.
+type configValidator struct {
+	path        string  // File being checked
+	merged      *Config // All files merged, as LoadConfig sees them
+	aliases     map[string]aliasDef
+	diagnostics []Diagnostic
+}
+
+// aliasDef is where an alias was first defined
+type aliasDef struct {
+	file  string
+	line  int
+	group string
+}
+
+// parsedFile is one config file decoded both ways
+type parsedFile struct {
+	path string
+	cfg  *Config
+	root *yaml.Node
+}
+
+func (v *configValidator) report(severity string, n *yaml.Node, format string, args ...interface{}) {
+	d := Diagnostic{File: v.path, Severity: severity, Message: fmt.Sprintf(format, args...)}
+	if n != nil {
+		d.Line, d.Column = n.Line, n.Column
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+func (v *configValidator) errorf(n *yaml.Node, format string, args ...interface{}) {
+	v.report(SeverityError, n, format, args...)
+}
+
+func (v *configValidator) warnf(n *yaml.Node, format string, args ...interface{}) {
+	v.report(SeverityWarning, n, format, args...)
+}
+
+// reportYAMLError turns a yaml.v3 error ("yaml: line 4: ...") into positioned diagnostics.
+// Unknown keys are only warnings since they are ignored when loading.
+func (v *configValidator) reportYAMLError(err error) {
+	messages := []string{err.Error()}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	}
+
+	for _, msg := range messages {
+		msg = strings.TrimPrefix(msg, "yaml: ")
+		d := Diagnostic{File: v.path, Severity: SeverityError, Message: msg}
+		if m := yamlErrorLine.FindStringSubmatchIndex(msg); m != nil {
+			d.Line, _ = strconv.Atoi(msg[m[2]:m[3]])
+			d.Column = 1
+			d.Message = msg[:m[0]] + msg[m[1]:]
+		}
+		if m := yamlUnknownField.FindStringSubmatch(d.Message); m != nil {
+			d.Severity = SeverityWarning
+			d.Message = fmt.Sprintf("unknown key '%s' in %s is ignored", m[1], strings.ToLower(m[2]))
+		}
+		v.diagnostics = append(v.diagnostics, d)
+	}
+}
+
+// ValidateConfig checks the config and its includes for problems that LoadConfig
+// accepts but that would fail later: duplicate aliases, missing hostnames, dangling
+// env and layout references, missing payload files and layouts that cannot be split.
+func ValidateConfig(path string) ([]Diagnostic, error) {
+	v := &configValidator{merged: &Config{}, aliases: make(map[string]aliasDef)}
+
+	// 1. Syntax, types and unknown keys, main file first for its include list
+	main, err := v.parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if main == nil {
+		return v.diagnostics, nil // Not parseable, nothing else to check
+	}
+	parsed := []*parsedFile{main}
+
+	files, err := includedFiles(path, main.cfg.Include)
+	if err != nil {
+		v.path = path
+		v.errorf(mappingValue(main.root, "include"), "%v", err)
+	}
+	for _, file := range files {
+		p, err := v.parseFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			parsed = append(parsed, p)
+		}
+	}
+
+	// 2. The node trees give us positions for the semantic checks
+	for _, p := range parsed {
+		v.merged.merge(p.cfg, p.path)
+	}
+	for _, p := range parsed {
+		v.path = p.path
+		v.checkSettings(p.cfg, mappingValue(p.root, "settings"))
+		v.checkGroups(p.cfg, mappingValue(p.root, "groups"))
+		v.checkPayloads(p.cfg, mappingValue(p.root, "payloads"))
+		v.checkLayouts(p.cfg, mappingValue(p.root, "layouts"))
+	}
+	v.path = path
+	v.checkAuthCheckEnv(parsed)
+
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		a, b := v.diagnostics[i], v.diagnostics[j]
+		if a.File != b.File {
+			return fileOrder(parsed, a.File) < fileOrder(parsed, b.File)
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Message < b.Message
+	})
+	return v.diagnostics, nil
+}
+
+// parseFile decodes one file, reporting syntax and type errors. It returns nil
+// when the file cannot be parsed at all.
+func (v *configValidator) parseFile(path string) (*parsedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	v.path = path
+
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		v.reportYAMLError(err)
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, nil
+		}
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return &parsedFile{path: path, cfg: &cfg, root: doc.Content[0]}, nil
+}
+
+// checkAuthCheckEnv makes sure 'wssh' can check key expiry with the merged settings
+func (v *configValidator) checkAuthCheckEnv(parsed []*parsedFile) {
+	s := v.merged.Settings
+	checkEnv := s.AuthCheckEnv
+	if checkEnv == "" {
+		if len(s.SSHAgentEnvs) == 0 {
+			return // No agents and nothing asked for, the check is skipped
+		}
+		checkEnv = "default"
+	}
+	if _, exists := s.SSHAgentEnvs[checkEnv]; exists {
+		return
+	}
+
+	// Point at the file that set auth_check_env last, or else at the first ssh_agent_envs
+	var n *yaml.Node
+	for _, p := range parsed {
+		settings := mappingValue(p.root, "settings")
+		if found := mappingValue(settings, "auth_check_env"); found != nil {
+			v.path, n = p.path, found
+		} else if found := mappingKey(settings, "ssh_agent_envs"); found != nil && n == nil {
+			v.path, n = p.path, found
+		}
+	}
+	v.errorf(n, "auth_check_env '%s' is not defined in ssh_agent_envs", checkEnv)
+}
+
+func fileOrder(parsed []*parsedFile, file string) int {
+	for i, p := range parsed {
+		if p.path == file {
+			return i
+		}
+	}
+	return len(parsed)
+}
+
+func (v *configValidator) checkSettings(cfg *Config, settings *yaml.Node) {
+	s := cfg.Settings
+	envs := mappingValue(settings, "ssh_agent_envs")
+
+	for name, env := range s.SSHAgentEnvs {
+		envNode := mappingValue(envs, name)
+		if env.Sock == "" {
+			v.errorf(mappingKey(envs, name), "agent env '%s' has no sock", name)
+		}
+		if env.Key == "" {
+			v.warnf(mappingKey(envs, name), "agent env '%s' has no key, 'wssh auth' cannot prime it", name)
+		} else if _, err := os.Stat(expandPath(env.Key)); err != nil {
+			v.warnf(mappingValue(envNode, "key"), "agent env '%s' key %s does not exist on this machine", name, env.Key)
+		}
+
+		matchNode := mappingValue(envNode, "match")
+		for i, pattern := range env.Match {
+			if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+				if _, err := regexp.Compile(pattern[1 : len(pattern)-1]); err != nil {
+					v.errorf(sequenceItem(matchNode, i), "invalid regex in agent env '%s': %v", name, err)
+				}
+			}
+		}
+	}
+
+	switch s.Terminal {
+	case "", "auto", "iterm", "iterm2", "tmux":
+	default:
+		v.errorf(mappingValue(settings, "terminal"), "unknown terminal '%s' (expected auto, iterm or tmux)", s.Terminal)
+	}
+
+	switch s.ConnectMode {
+	case "", "tab", "inline":
+	default:
+		v.errorf(mappingValue(settings, "connect_mode"), "unknown connect_mode '%s' (expected tab or inline)", s.ConnectMode)
+	}
+
+	switch s.SSHConfigMode {
+	case "", "block", "include":
+	default:
+		v.errorf(mappingValue(settings, "ssh_config_mode"), "unknown ssh_config_mode '%s' (expected block or include)", s.SSHConfigMode)
+	}
+
+	if s.TileLayout != "" && s.TileLayout != "auto" {
+		if _, err := ResolveLayout(s.TileLayout, v.merged); err != nil {
+			v.errorf(mappingValue(settings, "tile_layout"), "tile_layout: %v", err)
+		}
+	}
+	if s.TileMaxPanes < 0 {
+		v.errorf(mappingValue(settings, "tile_max_panes"), "tile_max_panes must be positive")
+	}
+	if s.BackupKeep < 0 {
+		v.errorf(mappingValue(settings, "backup_keep"), "backup_keep must be positive")
+	}
+}
+
+func (v *configValidator) checkGroups(cfg *Config, groups *yaml.Node) {
+	groupNames := make(map[string]int)
+
+	for gi, group := range cfg.Groups {
+		groupNode := sequenceItem(groups, gi)
+
+		// Groups may repeat across files (they are merged), but not within one
+		if group.Name == "" {
+			v.warnf(groupNode, "group has no name")
+		} else if line, exists := groupNames[strings.ToLower(group.Name)]; exists {
+			v.warnf(mappingValue(groupNode, "name"), "group '%s' is already defined at line %d", group.Name, line)
+		} else {
+			groupNames[strings.ToLower(group.Name)] = lineOf(mappingValue(groupNode, "name"))
+		}
+
+		v.checkAgentEnvRef(group.AgentEnv, mappingValue(groupNode, "agent_env"))
+
+		hostsNode := mappingValue(groupNode, "hosts")
+		for hi, host := range group.Hosts {
+			hostNode := sequenceItem(hostsNode, hi)
+			aliasNode := mappingValue(hostNode, "alias")
+
+			first, exists := v.aliases[host.Alias]
+			switch {
+			case host.Alias == "":
+				v.errorf(hostNode, "host in group '%s' has no alias", group.Name)
+			case exists && first.file == v.path:
+				v.errorf(aliasNode, "duplicate alias '%s', already defined at line %d in group '%s'", host.Alias, first.line, first.group)
+			case exists:
+				// LoadConfig lets the later file win, which is easy to do by accident
+				v.warnf(aliasNode, "alias '%s' replaces the host defined at %s:%d in group '%s'", host.Alias, shortPath(first.file), first.line, first.group)
+			default:
+				v.aliases[host.Alias] = aliasDef{file: v.path, line: lineOf(aliasNode), group: group.Name}
+			}
+
+			if host.Hostname == "" {
+				v.errorf(hostNode, "host '%s' has no hostname", host.Alias)
+			}
+
+			v.checkAgentEnvRef(host.AgentEnv, mappingValue(hostNode, "agent_env"))
+		}
+	}
+}
+
+// checkAgentEnvRef warns about agent_env names that fall through to the match rules
+func (v *configValidator) checkAgentEnvRef(name string, n *yaml.Node) {
+	if name == "" || name == noAgentEnv {
+		return
+	}
+	if _, exists := v.merged.Settings.SSHAgentEnvs[name]; !exists {
+		v.warnf(n, "agent_env '%s' is not defined in ssh_agent_envs, the match rules will be used instead", name)
+	}
+}
+
+// checkPayloads only warns: payload archives are local files that may only exist on some machines
+func (v *configValidator) checkPayloads(cfg *Config, payloads *yaml.Node) {
+	for name, path := range cfg.Payloads {
+		if path == "" {
+			v.errorf(mappingKey(payloads, name), "payload '%s' has no path", name)
+			continue
+		}
+		if _, err := os.Stat(expandPath(path)); err != nil {
+			v.warnf(mappingValue(payloads, name), "payload '%s' file %s does not exist", name, path)
+		}
+	}
+}
+
+func (v *configValidator) checkLayouts(cfg *Config, layouts *yaml.Node) {
+	known := make(map[string]bool)
+	for _, h := range buildSearchableHosts(v.merged) {
+		known[h.Alias] = true
+	}
+
+	for name, l := range cfg.Layouts {
+		layoutNode := mappingValue(layouts, name)
+		if err := l.validate(); err != nil {
+			v.errorf(mappingKey(layouts, name), "layout '%s': %v", name, err)
+		}
+
+		rowsNode := mappingValue(layoutNode, "rows")
+		for ri, row := range l.Rows {
+			commandsNode := mappingValue(sequenceItem(rowsNode, ri), "commands")
+			for ci, pc := range row.Commands {
+				if pc.Host != "" && !known[pc.Host] {
+					v.warnf(mappingValue(sequenceItem(commandsNode, ci), "host"), "layout '%s' pane host '%s' is not in the inventory", name, pc.Host)
+				}
+			}
+		}
+	}
+}
+
+// PrintDiagnostics prints the diagnostics followed by a summary and returns the error count
+func PrintDiagnostics(diagnostics []Diagnostic) int {
+	errs, warnings := 0, 0
+	for _, d := range diagnostics {
+		fmt.Println(d)
+		if d.Severity == SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+
+	if errs == 0 && warnings == 0 {
+		fmt.Println("✅ Config is valid")
+	} else {
+		fmt.Printf("\n%d error(s), %d warning(s)\n", errs, warnings)
+	}
+	return errs
+}
+
+// lineOf is the line of a node, or 0 when it is missing
+func lineOf(n *yaml.Node) int {
+	if n == nil {
+		return 0
+	}
+	return n.Line
+}